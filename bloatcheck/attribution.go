@@ -0,0 +1,202 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bloatcheck
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/clearlinux/diva/bundle"
+	"github.com/clearlinux/diva/diva"
+	"github.com/clearlinux/mixer-tools/swupd"
+)
+
+// unownedPackage is the package name files no package ships are attributed to
+const unownedPackage = "(unowned)"
+
+// FileChange is the change in size of a file installed by a bundle. Status is
+// one of "new", "deleted", "grown" or "shrunk".
+type FileChange struct {
+	Path     string
+	Status   string
+	FromSize int64
+	ToSize   int64
+	Change   int64
+}
+
+// PackageChange is the change in size of the files of a source package
+// installed by a bundle
+type PackageChange struct {
+	Name   string
+	Change int64
+}
+
+// Attribution explains the change in installed size of a bundle between two
+// builds. NewSize is the size of the files added, GrownSize the growth of the
+// files in both builds that got bigger. Files and Packages hold the files and
+// source packages with the largest growth, largest first.
+type Attribution struct {
+	Bundle     string
+	SizeChange int64
+	NewFiles   int
+	NewSize    int64
+	GrownFiles int
+	GrownSize  int64
+	Files      []FileChange
+	Packages   []PackageChange
+}
+
+// bundleFiles returns the size of every file installed by a bundle with the
+// include closure names, mapped by path
+func bundleFiles(manifests []*swupd.Manifest, sizes map[swupd.Hashval]int64, names []string) map[string]int64 {
+	include := make(map[string]bool)
+	for _, name := range names {
+		include[name] = true
+	}
+
+	files := make(map[string]int64)
+	for _, m := range manifests {
+		if !include[m.Name] {
+			continue
+		}
+		for _, f := range m.Files {
+			if f.Present() {
+				files[f.Name] = sizes[f.Hash]
+			}
+		}
+	}
+	return files
+}
+
+// GetBundleFiles gets the size of every file installed by each of the bundles
+// in a given version, including the files installed by their includes. The
+// manifests of the version must be cached.
+func GetBundleFiles(u diva.UInfo, bundlePath string, bundles []string) (map[string]map[string]int64, error) {
+	manifests, err := getManifests(u)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes, err := getFileSizes(u, manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]map[string]int64)
+	for _, name := range bundles {
+		includes, err := bundle.GetIncludesForBundle(name, bundlePath)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = bundleFiles(manifests, sizes, append(includes, name))
+	}
+	return files, nil
+}
+
+// AttributeSizeChange attributes the change in size of bundle from the files
+// in from to the files in to, both mapped by path, to the top files and source
+// packages. owner returns the source package shipping a path, or an empty
+// string if it is unknown. A top below 1 lists no files or packages.
+func AttributeSizeChange(bundle string, from, to map[string]int64, owner func(string) string, top int) Attribution {
+	a := Attribution{Bundle: bundle}
+	if top < 0 {
+		top = 0
+	}
+
+	var changes []FileChange
+	for path, size := range to {
+		c := FileChange{Path: path, ToSize: size}
+		old, ok := from[path]
+		switch {
+		case !ok:
+			c.Status = "new"
+			a.NewFiles++
+			a.NewSize += size
+		case size > old:
+			c.Status = "grown"
+			a.GrownFiles++
+			a.GrownSize += size - old
+		case size < old:
+			c.Status = "shrunk"
+		default:
+			continue
+		}
+		c.FromSize = old
+		c.Change = size - old
+		changes = append(changes, c)
+	}
+	for path, size := range from {
+		if _, ok := to[path]; !ok && size != 0 {
+			changes = append(changes, FileChange{Path: path, Status: "deleted", FromSize: size, Change: -size})
+		}
+	}
+
+	pkgChanges := make(map[string]int64)
+	for _, c := range changes {
+		// new empty files are listed but do not change the size of anything
+		if c.Change == 0 {
+			continue
+		}
+		a.SizeChange += c.Change
+		pkg := owner(c.Path)
+		if pkg == "" {
+			pkg = unownedPackage
+		}
+		pkgChanges[pkg] += c.Change
+	}
+	for name, change := range pkgChanges {
+		a.Packages = append(a.Packages, PackageChange{Name: name, Change: change})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Change != changes[j].Change {
+			return changes[i].Change > changes[j].Change
+		}
+		return changes[i].Path < changes[j].Path
+	})
+	sort.Slice(a.Packages, func(i, j int) bool {
+		if a.Packages[i].Change != a.Packages[j].Change {
+			return a.Packages[i].Change > a.Packages[j].Change
+		}
+		return a.Packages[i].Name < a.Packages[j].Name
+	})
+	if len(changes) > top {
+		changes = changes[:top]
+	}
+	if len(a.Packages) > top {
+		a.Packages = a.Packages[:top]
+	}
+	a.Files = changes
+	return a
+}
+
+// String describes the attribution in a form suitable for a test diagnostic
+func (a Attribution) String() string {
+	lines := []string{
+		fmt.Sprintf("size change: %+d bytes", a.SizeChange),
+		fmt.Sprintf("new files: %d (%+d bytes), grown files: %d (%+d bytes)",
+			a.NewFiles, a.NewSize, a.GrownFiles, a.GrownSize),
+		"top files:",
+	}
+	for _, f := range a.Files {
+		lines = append(lines, fmt.Sprintf("  %+d %s (%s)", f.Change, f.Path, f.Status))
+	}
+	lines = append(lines, "top source packages:")
+	for _, p := range a.Packages {
+		lines = append(lines, fmt.Sprintf("  %+d %s", p.Change, p.Name))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -15,18 +15,28 @@
 package bloatcheck
 
 import (
+	"encoding/json"
 	"fmt"
-	"sort"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sync"
 
 	"github.com/clearlinux/diva/bundle"
 	"github.com/clearlinux/diva/diva"
+	"github.com/clearlinux/diva/internal/helpers"
 	"github.com/clearlinux/mixer-tools/swupd"
-
-	"path/filepath"
 )
 
-var sizeMutex sync.RWMutex
+// BundleSize is the installed size of a bundle in bytes. Installed is the
+// size of the bundle together with every bundle it includes, counting each
+// distinct file content once no matter how many of the manifests list it.
+// Unique is the size of the content only the bundle itself installs, that is
+// not also installed by one of its includes.
+type BundleSize struct {
+	Installed int64
+	Unique    int64
+}
 
 func getManifests(u diva.UInfo) ([]*swupd.Manifest, error) {
 	baseCache := filepath.Join(u.CacheLoc, "update")
@@ -51,103 +61,270 @@ func getManifests(u diva.UInfo) ([]*swupd.Manifest, error) {
 	return manifests, nil
 }
 
-func findManifest(name string, fs []*swupd.File) *swupd.File {
-	i := sort.Search(len(fs), func(i int) bool {
-		return fs[i].Name >= name
-	})
+// sizeCachePath returns the path of the file recording the installed size of
+// the file content measured so far, by hash, in the cache of u
+func sizeCachePath(u diva.UInfo) string {
+	return filepath.Join(u.CacheLoc, "update", "content-sizes.json")
+}
 
-	if i < len(fs) && fs[i].Name == name {
-		return fs[i]
+// loadSizeCache reads the content sizes recorded at path. There are none
+// when the file does not exist yet.
+func loadSizeCache(path string) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return sizes, nil
 	}
-
-	return nil
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, &sizes); err != nil {
+		return nil, fmt.Errorf("invalid size cache %s: %v", path, err)
+	}
+	return sizes, nil
 }
 
-// Concurrently gets the size for each manifest
-func getSizes(u diva.UInfo, m *swupd.Manifest, mom *swupd.Manifest, bundleSizes map[string]int64, bundlePath string) error {
-	if m.Name == "os-core-update-index" {
-		return nil
+// saveSizeCache records sizes at path, replacing the file in one step so a
+// concurrent reader never sees it half written
+func saveSizeCache(path string, sizes map[string]int64) error {
+	b, err := json.Marshal(sizes)
+	if err != nil {
+		return err
 	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// packThreshold is the number of files of a bundle of unknown size above which
+// the zero pack of the bundle is downloaded to measure them, rather than the
+// fullfile of each of them
+const packThreshold = 16
 
-	includes, err := bundle.GetIncludesForBundle(m.Name, bundlePath)
+// extractSizes downloads the tar file at url to a temporary directory,
+// extracts it and returns the size of each of paths, which are relative to the
+// directory the tar file extracts into. The extracted content is removed once
+// measured, so measuring content does not keep a copy of it.
+func extractSizes(url string, paths []string) ([]int64, error) {
+	dir, err := ioutil.TempDir("", "diva-content")
 	if err != nil {
-		fmt.Printf("Failed to get includes for manifest %s\n", m.Name)
-		return err
+		return nil, err
 	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
 
-	baseCache := filepath.Join(u.CacheLoc, "update")
-	for _, i := range includes {
-		manifestFile := findManifest(i, mom.Files)
-		if manifestFile == nil {
-			return err
-		}
-		path := filepath.Join(baseCache, fmt.Sprint(manifestFile.Version), "Manifest."+i)
-		includeManifest, err := swupd.ParseManifestFile(path)
+	if err = helpers.TarExtractURL(url, filepath.Join(dir, "content.tar")); err != nil {
+		return nil, fmt.Errorf("failed to download %s: %v", url, err)
+	}
+	sizes := make([]int64, len(paths))
+	for i, path := range paths {
+		fi, err := os.Lstat(filepath.Join(dir, path))
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("no %s in %s: %v", path, url, err)
 		}
-		sizeMutex.Lock()
-		bundleSizes[m.Name] += int64(includeManifest.Header.ContentSize)
-		sizeMutex.Unlock()
+		sizes[i] = fi.Size()
 	}
-	sizeMutex.Lock()
-	bundleSizes[m.Name] += int64(m.Header.ContentSize)
-	sizeMutex.Unlock()
+	return sizes, nil
+}
 
-	return nil
+// measureContent returns the size of the content of files, which are listed
+// in manifest m. Many files are measured from the zero pack of the bundle in a
+// single download, falling back to the fullfile of every file if there is no
+// zero pack.
+func measureContent(u diva.UInfo, m *swupd.Manifest, files []*swupd.File) (map[swupd.Hashval]int64, error) {
+	sizes := make(map[swupd.Hashval]int64)
+	if len(files) > packThreshold {
+		url := fmt.Sprintf("%s/update/%d/pack-%s-from-0.tar", u.URL, m.Header.Version, m.Name)
+		paths := make([]string, len(files))
+		for i, f := range files {
+			paths[i] = filepath.Join("staged", f.Hash.String())
+		}
+		if measured, err := extractSizes(url, paths); err == nil {
+			for i, f := range files {
+				sizes[f.Hash] = measured[i]
+			}
+			return sizes, nil
+		}
+	}
+
+	for _, f := range files {
+		url := fmt.Sprintf("%s/update/%d/files/%s.tar", u.URL, f.Version, f.Hash)
+		measured, err := extractSizes(url, []string{f.Hash.String()})
+		if err != nil {
+			return nil, fmt.Errorf("failed to measure %s in %s: %v", f.Name, m.Name, err)
+		}
+		sizes[f.Hash] = measured[0]
+	}
+	return sizes, nil
 }
 
-// GetBundleSize gets the full size of all bundles in a given version
-func GetBundleSize(u diva.UInfo, bundlePath string) (map[string]int64, error) {
-	manifests, err := getManifests(u)
+// fileSizes returns the size of every distinct file content in manifests.
+// Directories take no space of their own and symlinks the length of their
+// target. Sizes are looked up by hash in known first and then in the fullfile
+// content cached by diva.FetchUpdateFiles, and only the remaining content is
+// downloaded and measured. Every size found is added to known.
+func fileSizes(u diva.UInfo, manifests []*swupd.Manifest, known map[string]int64) (map[swupd.Hashval]int64, error) {
+	baseCache := filepath.Join(u.CacheLoc, "update")
+	sizes := make(map[swupd.Hashval]int64)
+	missing := make(map[*swupd.Manifest][]*swupd.File)
+	queued := make(map[swupd.Hashval]bool)
+	for _, m := range manifests {
+		for _, f := range m.Files {
+			if !f.Present() || f.Type == swupd.TypeDirectory || queued[f.Hash] {
+				continue
+			}
+			if _, ok := sizes[f.Hash]; ok {
+				continue
+			}
+			if size, ok := known[f.Hash.String()]; ok {
+				sizes[f.Hash] = size
+				continue
+			}
+			path := filepath.Join(baseCache, fmt.Sprint(f.Version), "files", f.Hash.String())
+			if fi, err := os.Lstat(path); err == nil {
+				sizes[f.Hash] = fi.Size()
+				continue
+			}
+			queued[f.Hash] = true
+			missing[m] = append(missing[m], f)
+		}
+	}
 
 	var wg sync.WaitGroup
-	bundleWorkers := len(manifests)
+	var mu sync.Mutex
+	var firstErr error
+	nworkers := 8
+	wg.Add(nworkers)
 	mChan := make(chan *swupd.Manifest)
-	errChan := make(chan error, bundleWorkers)
-	wg.Add(bundleWorkers)
+	for i := 0; i < nworkers; i++ {
+		go func() {
+			defer wg.Done()
+			for m := range mChan {
+				measured, err := measureContent(u, m, missing[m])
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				for hash, size := range measured {
+					sizes[hash] = size
+				}
+				mu.Unlock()
+			}
+		}()
+	}
 
-	var bundleSizes = make(map[string]int64)
+	for m := range missing {
+		mChan <- m
+	}
+	close(mChan)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
 
-	baseCache := filepath.Join(u.CacheLoc, "update")
-	momPath := filepath.Join(baseCache, fmt.Sprint(u.Ver), "Manifest.MoM")
+	for hash, size := range sizes {
+		known[hash.String()] = size
+	}
+	return sizes, nil
+}
 
-	mom, err := swupd.ParseManifestFile(momPath)
+// getFileSizes returns the size of every distinct file content in manifests,
+// recording the sizes in the size cache of u so content is only downloaded to
+// be measured once
+func getFileSizes(u diva.UInfo, manifests []*swupd.Manifest) (map[swupd.Hashval]int64, error) {
+	path := sizeCachePath(u)
+	known, err := loadSizeCache(path)
 	if err != nil {
 		return nil, err
 	}
+	sizes, err := fileSizes(u, manifests, known)
+	if err != nil {
+		return nil, err
+	}
+	return sizes, saveSizeCache(path, known)
+}
 
-	sort.Slice(mom.Files, func(i, j int) bool {
-		return mom.Files[i].Name < mom.Files[j].Name
-	})
-
-	for i := 0; i < bundleWorkers; i++ {
-		go func() {
-			defer wg.Done()
-			for m := range mChan {
-				// Get the total size for each bundle (without accounting for overlap between them)
-				err = getSizes(u, m, mom, bundleSizes, bundlePath)
-				if err != nil {
-					errChan <- err
-				}
+// contentSize returns the total size of the distinct file content in
+// manifests, skipping the content in exclude
+func contentSize(manifests []*swupd.Manifest, sizes map[swupd.Hashval]int64, exclude map[swupd.Hashval]bool) int64 {
+	seen := make(map[swupd.Hashval]bool)
+	var size int64
+	for _, m := range manifests {
+		for _, f := range m.Files {
+			if !f.Present() || seen[f.Hash] || exclude[f.Hash] {
+				continue
 			}
-		}()
+			seen[f.Hash] = true
+			size += sizes[f.Hash]
+		}
+	}
+	return size
+}
+
+// bundleSizes returns the size of every bundle in manifests. includes returns
+// the include closure of a bundle, which may contain the bundle itself.
+func bundleSizes(manifests []*swupd.Manifest, sizes map[swupd.Hashval]int64, includes func(string) ([]string, error)) (map[string]BundleSize, error) {
+	byName := make(map[string]*swupd.Manifest)
+	for _, m := range manifests {
+		byName[m.Name] = m
 	}
 
+	result := make(map[string]BundleSize)
 	for _, m := range manifests {
-		select {
-		case mChan <- m:
-		case err = <-errChan:
-			break
+		if m.Name == "os-core-update-index" {
+			continue
+		}
+
+		names, err := includes(m.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get includes for manifest %s: %v", m.Name, err)
+		}
+
+		var included []*swupd.Manifest
+		includedContent := make(map[swupd.Hashval]bool)
+		for _, name := range names {
+			im, ok := byName[name]
+			if !ok || name == m.Name {
+				continue
+			}
+			included = append(included, im)
+			for _, f := range im.Files {
+				if f.Present() {
+					includedContent[f.Hash] = true
+				}
+			}
+		}
+
+		result[m.Name] = BundleSize{
+			Installed: contentSize(append(included, m), sizes, nil),
+			Unique:    contentSize([]*swupd.Manifest{m}, sizes, includedContent),
 		}
 	}
-	close(mChan)
-	wg.Wait()
+	return result, nil
+}
+
+// GetBundleSize gets the installed size of all bundles in a given version. The
+// manifests of the version must be cached, as done by diva.FetchUpdate. The
+// file content is measured in the cache when it is there and downloaded
+// otherwise, see fileSizes.
+func GetBundleSize(u diva.UInfo, bundlePath string) (map[string]BundleSize, error) {
+	manifests, err := getManifests(u)
+	if err != nil {
+		return nil, err
+	}
 
-	chanLen := len(errChan)
-	for i := 0; i < chanLen; i++ {
-		<-errChan
+	sizes, err := getFileSizes(u, manifests)
+	if err != nil {
+		return nil, err
 	}
 
-	return bundleSizes, err
+	return bundleSizes(manifests, sizes, func(name string) ([]string, error) {
+		return bundle.GetIncludesForBundle(name, bundlePath)
+	})
 }
@@ -0,0 +1,161 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bloatcheck
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/clearlinux/mixer-tools/swupd"
+)
+
+func TestBundleSizes(t *testing.T) {
+	manifests := []*swupd.Manifest{
+		{Name: "os-core", Files: []*swupd.File{
+			{Name: "/usr/bin/sh", Hash: 1},
+			{Name: "/usr/lib/libc.so", Hash: 2},
+		}},
+		{Name: "editors", Files: []*swupd.File{
+			{Name: "/usr/bin/vim", Hash: 3},
+			// same content as the vim binary
+			{Name: "/usr/bin/vi", Hash: 3},
+			// shipped by os-core too
+			{Name: "/usr/lib/libc.so", Hash: 2},
+		}},
+		{Name: "os-core-update-index"},
+	}
+	sizes := map[swupd.Hashval]int64{1: 100, 2: 1000, 3: 10}
+	includes := map[string][]string{
+		"os-core": {"os-core"},
+		"editors": {"editors", "os-core"},
+	}
+
+	got, err := bundleSizes(manifests, sizes, func(name string) ([]string, error) {
+		return includes[name], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]BundleSize{
+		"os-core": {Installed: 1100, Unique: 1100},
+		"editors": {Installed: 1110, Unique: 10},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v but got %v", expected, got)
+	}
+}
+
+func TestSizeCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sizes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	path := filepath.Join(dir, "update", "content-sizes.json")
+	sizes, err := loadSizeCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sizes) != 0 {
+		t.Fatalf("expected no sizes without a cache but got %v", sizes)
+	}
+
+	sizes["abc"] = 100
+	sizes["def"] = 0
+	if err = saveSizeCache(path, sizes); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadSizeCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, sizes) {
+		t.Errorf("expected %v but got %v", sizes, got)
+	}
+
+	if err = ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = loadSizeCache(path); err == nil {
+		t.Error("expected an error for an invalid cache")
+	}
+}
+
+func TestAttributeSizeChange(t *testing.T) {
+	from := map[string]int64{
+		"/usr/bin/grow":   100,
+		"/usr/bin/shrink": 50,
+		"/usr/bin/gone":   30,
+		"/usr/bin/same":   10,
+	}
+	to := map[string]int64{
+		"/usr/bin/grow":   300,
+		"/usr/bin/shrink": 40,
+		"/usr/bin/same":   10,
+		"/usr/lib/new.so": 500,
+		"/usr/share/doc":  0,
+	}
+	owners := map[string]string{
+		"/usr/bin/grow":   "tools",
+		"/usr/bin/shrink": "tools",
+		"/usr/lib/new.so": "libnew",
+	}
+	owner := func(path string) string {
+		return owners[path]
+	}
+
+	a := AttributeSizeChange("editors", from, to, owner, 2)
+	expected := Attribution{
+		Bundle:     "editors",
+		SizeChange: 660,
+		NewFiles:   2,
+		NewSize:    500,
+		GrownFiles: 1,
+		GrownSize:  200,
+		Files: []FileChange{
+			{Path: "/usr/lib/new.so", Status: "new", ToSize: 500, Change: 500},
+			{Path: "/usr/bin/grow", Status: "grown", FromSize: 100, ToSize: 300, Change: 200},
+		},
+		Packages: []PackageChange{
+			{Name: "libnew", Change: 500},
+			{Name: "tools", Change: 190},
+		},
+	}
+	if !reflect.DeepEqual(a, expected) {
+		t.Errorf("expected %+v but got %+v", expected, a)
+	}
+	a = AttributeSizeChange("editors", from, to, owner, 10)
+	var newFiles int
+	for _, f := range a.Files {
+		if f.Status == "new" {
+			newFiles++
+		}
+	}
+	if len(a.Files) != 5 || newFiles != a.NewFiles {
+		t.Errorf("expected all 5 changed files with the %d new files listed but got %+v", a.NewFiles, a.Files)
+	}
+
+	a = AttributeSizeChange("editors", from, to, owner, -1)
+	if len(a.Files) != 0 || len(a.Packages) != 0 || a.SizeChange != 660 {
+		t.Errorf("expected only totals with a negative top but got %+v", a)
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bloatcheck
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/clearlinux/diva/bundle"
+	"github.com/clearlinux/diva/diva"
+	"github.com/clearlinux/diva/internal/helpers"
+	"github.com/clearlinux/mixer-tools/swupd"
+)
+
+// SizeFunc returns the size of the file at path under the update directory of
+// an update server, such as "100/pack-os-core-from-0.tar", and false if the
+// server has no such file
+type SizeFunc func(path string) (int64, bool, error)
+
+// Upgrade is the download size of updating a bundle between two versions.
+// DeltaPack is false when there is no delta pack for the update and Size is
+// the size of the fullfiles of the changed content, which swupd falls back to.
+type Upgrade struct {
+	Size      int64
+	DeltaPack bool
+}
+
+// RemoteSizes returns a SizeFunc for the update server at u.URL. Files cached
+// under u.CacheLoc are measured on disk and any other file with a HEAD
+// request. Every size is remembered, so it is only asked for once.
+func RemoteSizes(u diva.UInfo) SizeFunc {
+	type answer struct {
+		size  int64
+		found bool
+	}
+	var mu sync.Mutex
+	answers := make(map[string]answer)
+
+	return func(path string) (int64, bool, error) {
+		mu.Lock()
+		a, ok := answers[path]
+		mu.Unlock()
+		if ok {
+			return a.size, a.found, nil
+		}
+
+		if fi, err := os.Lstat(filepath.Join(u.CacheLoc, "update", path)); err == nil {
+			a = answer{fi.Size(), true}
+		} else {
+			size, found, err := helpers.ContentLength(fmt.Sprintf("%s/update/%s", u.URL, path))
+			if err != nil {
+				return 0, false, err
+			}
+			a = answer{size, found}
+		}
+
+		mu.Lock()
+		answers[path] = a
+		mu.Unlock()
+		return a.size, a.found, nil
+	}
+}
+
+func packPath(m *swupd.Manifest, from uint32) string {
+	return fmt.Sprintf("%d/pack-%s-from-%d.tar", m.Header.Version, m.Name, from)
+}
+
+func fullfilePath(f *swupd.File) string {
+	return fmt.Sprintf("%d/files/%s.tar", f.Version, f.Hash)
+}
+
+// measure returns the size of the file at every path, and whether it exists,
+// asking size for several of them at a time
+func measure(paths []string, size SizeFunc) ([]int64, []bool, error) {
+	sizes := make([]int64, len(paths))
+	found := make([]bool, len(paths))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	nworkers := 8
+	wg.Add(nworkers)
+	idx := make(chan int)
+	for i := 0; i < nworkers; i++ {
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				s, ok, err := size(paths[i])
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					continue
+				}
+				sizes[i], found[i] = s, ok
+			}
+		}()
+	}
+
+	for i := range paths {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
+	return sizes, found, firstErr
+}
+
+// measurePacks returns the size of the pack from the from version of every
+// bundle in manifests that has one. from returns the version to get the pack
+// of a bundle from, and false when the bundle needs none.
+func measurePacks(manifests []*swupd.Manifest, from func(*swupd.Manifest) (uint32, bool), size SizeFunc) (map[string]int64, error) {
+	var names, paths []string
+	for _, m := range manifests {
+		if v, ok := from(m); ok {
+			names = append(names, m.Name)
+			paths = append(paths, packPath(m, v))
+		}
+	}
+
+	sizes, found, err := measure(paths, size)
+	if err != nil {
+		return nil, err
+	}
+	packs := make(map[string]int64)
+	for i, name := range names {
+		if found[i] {
+			packs[name] = sizes[i]
+		}
+	}
+	return packs, nil
+}
+
+// measureFullfiles returns the size of the fullfile of every distinct content
+// in files. Content without a fullfile on the server is an error, swupd could
+// not download it either.
+func measureFullfiles(files []*swupd.File, size SizeFunc) (map[swupd.Hashval]int64, error) {
+	var hashes []swupd.Hashval
+	var paths []string
+	seen := make(map[swupd.Hashval]bool)
+	for _, f := range files {
+		if seen[f.Hash] {
+			continue
+		}
+		seen[f.Hash] = true
+		hashes = append(hashes, f.Hash)
+		paths = append(paths, fullfilePath(f))
+	}
+
+	sizes, found, err := measure(paths, size)
+	if err != nil {
+		return nil, err
+	}
+	fullfiles := make(map[swupd.Hashval]int64)
+	for i, h := range hashes {
+		if !found[i] {
+			return nil, fmt.Errorf("no fullfile at %s", paths[i])
+		}
+		fullfiles[h] = sizes[i]
+	}
+	return fullfiles, nil
+}
+
+// presentFiles returns the files of m that are not deleted, with a version of
+// at least minVer
+func presentFiles(m *swupd.Manifest, minVer uint32) []*swupd.File {
+	var files []*swupd.File
+	for _, f := range m.Files {
+		if f.Present() && f.Version >= minVer {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// fullfilesSize returns the total size of the fullfiles of the distinct
+// content in files
+func fullfilesSize(files []*swupd.File, fullfiles map[swupd.Hashval]int64) int64 {
+	seen := make(map[swupd.Hashval]bool)
+	var size int64
+	for _, f := range files {
+		if !seen[f.Hash] {
+			seen[f.Hash] = true
+			size += fullfiles[f.Hash]
+		}
+	}
+	return size
+}
+
+// freshSizes returns the download size of a fresh install of every bundle in
+// manifests, which is the size of the zero pack of the bundle and of each of
+// its includes. packs holds the zero pack sizes of the bundles that have one
+// and fullfiles the fullfile sizes of the content of those that do not.
+func freshSizes(manifests []*swupd.Manifest, packs map[string]int64, fullfiles map[swupd.Hashval]int64, includes func(string) ([]string, error)) (map[string]int64, error) {
+	own := make(map[string]int64)
+	for _, m := range manifests {
+		if size, ok := packs[m.Name]; ok {
+			own[m.Name] = size
+		} else {
+			own[m.Name] = fullfilesSize(presentFiles(m, 0), fullfiles)
+		}
+	}
+
+	result := make(map[string]int64)
+	for _, m := range manifests {
+		if m.Name == "os-core-update-index" {
+			continue
+		}
+
+		names, err := includes(m.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get includes for manifest %s: %v", m.Name, err)
+		}
+
+		size := own[m.Name]
+		for _, name := range names {
+			if name != m.Name {
+				size += own[name]
+			}
+		}
+		result[m.Name] = size
+	}
+	return result, nil
+}
+
+// bundlePairs returns the manifests of the bundles in both from and to, as
+// the from and to manifest of each, skipping os-core-update-index
+func bundlePairs(from, to []*swupd.Manifest) map[string][2]*swupd.Manifest {
+	fromBundles := make(map[string]*swupd.Manifest)
+	for _, m := range from {
+		fromBundles[m.Name] = m
+	}
+
+	pairs := make(map[string][2]*swupd.Manifest)
+	for _, m := range to {
+		if old, ok := fromBundles[m.Name]; ok && m.Name != "os-core-update-index" {
+			pairs[m.Name] = [2]*swupd.Manifest{old, m}
+		}
+	}
+	return pairs
+}
+
+// upgradeSizes returns the download size of updating every bundle in both
+// from and to. deltas holds the sizes of the delta packs that exist and
+// fullfiles the fullfile sizes of the content changed in the bundles without
+// one. Bundles that did not change need no download.
+func upgradeSizes(from, to []*swupd.Manifest, deltas map[string]int64, fullfiles map[swupd.Hashval]int64) map[string]Upgrade {
+	result := make(map[string]Upgrade)
+	for name, pair := range bundlePairs(from, to) {
+		old, m := pair[0], pair[1]
+		switch size, ok := deltas[name]; {
+		case old.Header.Version == m.Header.Version:
+			result[name] = Upgrade{}
+		case ok:
+			result[name] = Upgrade{Size: size, DeltaPack: true}
+		default:
+			changed := presentFiles(m, old.Header.Version+1)
+			result[name] = Upgrade{Size: fullfilesSize(changed, fullfiles)}
+		}
+	}
+	return result
+}
+
+// GetDownloadSizes gets the download size of a fresh install of every bundle
+// in a given version. The manifests of the version must be cached, as done by
+// diva.FetchUpdate. The zero packs of the bundles are measured with size, as
+// are the fullfiles of the bundles that have no zero pack.
+func GetDownloadSizes(u diva.UInfo, bundlePath string, size SizeFunc) (map[string]int64, error) {
+	manifests, err := getManifests(u)
+	if err != nil {
+		return nil, err
+	}
+
+	packs, err := measurePacks(manifests, func(*swupd.Manifest) (uint32, bool) {
+		return 0, true
+	}, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*swupd.File
+	for _, m := range manifests {
+		if _, ok := packs[m.Name]; !ok {
+			files = append(files, presentFiles(m, 0)...)
+		}
+	}
+	fullfiles, err := measureFullfiles(files, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return freshSizes(manifests, packs, fullfiles, func(name string) ([]string, error) {
+		return bundle.GetIncludesForBundle(name, bundlePath)
+	})
+}
+
+// GetUpgradeSizes gets the download size of updating every bundle in both
+// the from and to versions from one to the other. The manifests of both
+// versions must be cached, as done by diva.FetchUpdate. The delta packs are
+// measured with size, as are the changed fullfiles of the bundles that have
+// no delta pack.
+func GetUpgradeSizes(from, to diva.UInfo, size SizeFunc) (map[string]Upgrade, error) {
+	fromManifests, err := getManifests(from)
+	if err != nil {
+		return nil, err
+	}
+	toManifests, err := getManifests(to)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := bundlePairs(fromManifests, toManifests)
+	deltas, err := measurePacks(toManifests, func(m *swupd.Manifest) (uint32, bool) {
+		pair, ok := pairs[m.Name]
+		if !ok || pair[0].Header.Version == m.Header.Version {
+			return 0, false
+		}
+		return pair[0].Header.Version, true
+	}, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*swupd.File
+	for name, pair := range pairs {
+		if _, ok := deltas[name]; !ok && pair[0].Header.Version != pair[1].Header.Version {
+			files = append(files, presentFiles(pair[1], pair[0].Header.Version+1)...)
+		}
+	}
+	fullfiles, err := measureFullfiles(files, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return upgradeSizes(fromManifests, toManifests, deltas, fullfiles), nil
+}
@@ -0,0 +1,118 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bloatcheck
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/clearlinux/mixer-tools/swupd"
+)
+
+func TestMeasurePacks(t *testing.T) {
+	manifests := []*swupd.Manifest{
+		{Name: "os-core", Header: swupd.ManifestHeader{Version: 20}},
+		{Name: "editors", Header: swupd.ManifestHeader{Version: 30}},
+		{Name: "kernel", Header: swupd.ManifestHeader{Version: 10}},
+	}
+	server := map[string]int64{
+		"20/pack-os-core-from-10.tar": 500,
+		"30/pack-editors-from-0.tar":  300,
+	}
+	size := func(path string) (int64, bool, error) {
+		s, ok := server[path]
+		return s, ok, nil
+	}
+	from := map[string]uint32{"os-core": 10, "editors": 0, "kernel": 5}
+
+	packs, err := measurePacks(manifests, func(m *swupd.Manifest) (uint32, bool) {
+		v, ok := from[m.Name]
+		return v, ok
+	}, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int64{"os-core": 500, "editors": 300}
+	if !reflect.DeepEqual(packs, expected) {
+		t.Errorf("expected %v but got %v", expected, packs)
+	}
+}
+
+func TestFreshSizes(t *testing.T) {
+	manifests := []*swupd.Manifest{
+		{Name: "os-core", Files: []*swupd.File{
+			{Name: "/usr/bin/sh", Hash: 1},
+		}},
+		{Name: "editors", Files: []*swupd.File{
+			{Name: "/usr/bin/vim", Hash: 2},
+			// same content as the vim binary
+			{Name: "/usr/bin/vi", Hash: 2},
+			{Name: "/usr/share/vim", Hash: 3},
+		}},
+		{Name: "os-core-update-index"},
+	}
+	// editors has no zero pack
+	packs := map[string]int64{"os-core": 1000}
+	fullfiles := map[swupd.Hashval]int64{2: 40, 3: 5}
+	includes := map[string][]string{
+		"os-core": {"os-core"},
+		"editors": {"editors", "os-core"},
+	}
+
+	got, err := freshSizes(manifests, packs, fullfiles, func(name string) ([]string, error) {
+		return includes[name], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int64{"os-core": 1000, "editors": 1045}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v but got %v", expected, got)
+	}
+}
+
+func TestUpgradeSizes(t *testing.T) {
+	from := []*swupd.Manifest{
+		{Name: "os-core", Header: swupd.ManifestHeader{Version: 10}},
+		{Name: "editors", Header: swupd.ManifestHeader{Version: 10}},
+		{Name: "kernel", Header: swupd.ManifestHeader{Version: 10}},
+		{Name: "removed", Header: swupd.ManifestHeader{Version: 10}},
+	}
+	to := []*swupd.Manifest{
+		{Name: "os-core", Header: swupd.ManifestHeader{Version: 20}},
+		{Name: "editors", Header: swupd.ManifestHeader{Version: 20}, Files: []*swupd.File{
+			{Name: "/usr/bin/vim", Hash: 1, Version: 20},
+			{Name: "/usr/bin/vi", Hash: 1, Version: 20},
+			{Name: "/usr/share/vim", Hash: 2, Version: 15},
+			{Name: "/usr/share/doc", Hash: 3, Version: 10},
+		}},
+		{Name: "kernel", Header: swupd.ManifestHeader{Version: 10}},
+		{Name: "added", Header: swupd.ManifestHeader{Version: 20}},
+	}
+	deltas := map[string]int64{"os-core": 700}
+	fullfiles := map[swupd.Hashval]int64{1: 100, 2: 20, 3: 1000}
+
+	got := upgradeSizes(from, to, deltas, fullfiles)
+	expected := map[string]Upgrade{
+		"os-core": {Size: 700, DeltaPack: true},
+		"editors": {Size: 120},
+		"kernel":  {},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v but got %v", expected, got)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bloatcheck
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Levels of a Limit and of a Verdict
+const (
+	LevelPass = "pass"
+	LevelWarn = "warn"
+	LevelFail = "fail"
+)
+
+// Limit caps the growth of the bundles matching Bundles, which is a bundle
+// name or a glob such as "kernel-*". A bundle exceeds the limit when it grows
+// by more than MaxPercent percent or by more than MaxBytes bytes, a zero value
+// disables that cap. Level is either "warn" or "fail".
+type Limit struct {
+	Bundles    string  `toml:"bundles"`
+	MaxPercent float64 `toml:"max_percent"`
+	MaxBytes   int64   `toml:"max_bytes"`
+	Level      string  `toml:"level"`
+}
+
+// Exemption allows the bundles matching Bundles to exceed their limits until
+// the Expires date, for the documented Reason
+type Exemption struct {
+	Bundles string    `toml:"bundles"`
+	Expires time.Time `toml:"expires"`
+	Reason  string    `toml:"reason"`
+}
+
+// Policy is the set of size limits and exemptions bundles are checked against.
+// Every limit matching a bundle applies to it. A policy file is TOML with a
+// [[limit]] table per limit and an [[exemption]] table per exemption:
+//
+//	[[limit]]
+//	  bundles = "os-core*"
+//	  max_percent = 10.0
+//	  level = "fail"
+//
+//	[[exemption]]
+//	  bundles = "kernel-native"
+//	  expires = 2019-01-31
+//	  reason = "new firmware is split out next release"
+type Policy struct {
+	Limits     []Limit     `toml:"limit"`
+	Exemptions []Exemption `toml:"exemption"`
+}
+
+// Verdict is the result of checking the size change of a bundle against a
+// Policy. Exceeded describes every limit the bundle grew past. Exemption is
+// set when an exemption turned a warning or failure into a pass, and Expired
+// when only an expired exemption matched the bundle.
+type Verdict struct {
+	Level     string
+	Exceeded  []string
+	Exemption *Exemption
+	Expired   *Exemption
+}
+
+// highPrioBundles may affect many other bundles and minimal installations, so
+// growing them past the cap is fatal in the default policy
+var highPrioBundles = []string{"os-core", "os-core-update", "c-basic", "kernel"}
+
+// DefaultPolicy returns the policy used when no policy file is configured.
+// The high priority bundles fail when they grow by more than failCap percent
+// and every bundle warns when it grows by more than warnCap percent.
+func DefaultPolicy(failCap, warnCap float64) *Policy {
+	p := &Policy{}
+	for _, b := range highPrioBundles {
+		p.Limits = append(p.Limits, Limit{Bundles: b, MaxPercent: failCap, Level: LevelFail})
+	}
+	p.Limits = append(p.Limits, Limit{Bundles: "*", MaxPercent: warnCap, Level: LevelWarn})
+	return p
+}
+
+// LoadPolicy reads the policy file at path
+func LoadPolicy(path string) (*Policy, error) {
+	var p Policy
+	md, err := toml.DecodeFile(path, &p)
+	if err != nil {
+		return nil, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("%s: unknown key %s", path, undecoded[0])
+	}
+	if err = p.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &p, nil
+}
+
+func validGlob(glob string) bool {
+	_, err := path.Match(glob, "")
+	return glob != "" && err == nil
+}
+
+func (p *Policy) validate() error {
+	for _, l := range p.Limits {
+		if !validGlob(l.Bundles) {
+			return fmt.Errorf("invalid bundles %q in limit", l.Bundles)
+		}
+		if l.Level != LevelWarn && l.Level != LevelFail {
+			return fmt.Errorf("limit for %s has level %q, expected warn or fail", l.Bundles, l.Level)
+		}
+		if l.MaxPercent <= 0 && l.MaxBytes <= 0 {
+			return fmt.Errorf("limit for %s sets neither max_percent nor max_bytes", l.Bundles)
+		}
+	}
+	for _, e := range p.Exemptions {
+		if !validGlob(e.Bundles) {
+			return fmt.Errorf("invalid bundles %q in exemption", e.Bundles)
+		}
+		if e.Expires.IsZero() {
+			return fmt.Errorf("exemption for %s has no expiry", e.Bundles)
+		}
+		if strings.TrimSpace(e.Reason) == "" {
+			return fmt.Errorf("exemption for %s has no reason", e.Bundles)
+		}
+	}
+	return nil
+}
+
+func matches(glob, bundle string) bool {
+	ok, _ := path.Match(glob, bundle)
+	return ok
+}
+
+// exceeds returns a description of how l was exceeded by a bundle growing
+// from the from to the to size, or an empty string if it was not
+func (l Limit) exceeds(from, to int64) string {
+	diff := to - from
+	if l.MaxPercent > 0 && from > 0 && float64(diff) > float64(from)*l.MaxPercent/100 {
+		return fmt.Sprintf("grew by %3.2f%%, more than the %s limit of %g%% for %s",
+			float64(diff)/float64(from)*100, l.Level, l.MaxPercent, l.Bundles)
+	}
+	if l.MaxBytes > 0 && diff > l.MaxBytes {
+		return fmt.Sprintf("grew by %d bytes, more than the %s limit of %d bytes for %s",
+			diff, l.Level, l.MaxBytes, l.Bundles)
+	}
+	return ""
+}
+
+// Check checks bundle growing from the from to the to size against the limits
+// of p. Exemptions are only honored before they expire at now.
+func (p *Policy) Check(bundle string, from, to int64, now time.Time) Verdict {
+	v := Verdict{Level: LevelPass}
+	for _, l := range p.Limits {
+		if !matches(l.Bundles, bundle) {
+			continue
+		}
+		desc := l.exceeds(from, to)
+		if desc == "" {
+			continue
+		}
+		v.Exceeded = append(v.Exceeded, desc)
+		if v.Level != LevelFail {
+			v.Level = l.Level
+		}
+	}
+	if v.Level == LevelPass {
+		return v
+	}
+
+	for i := range p.Exemptions {
+		e := &p.Exemptions[i]
+		if !matches(e.Bundles, bundle) {
+			continue
+		}
+		if now.Before(e.Expires) {
+			v.Level = LevelPass
+			v.Exemption = e
+			v.Expired = nil
+			return v
+		}
+		v.Expired = e
+	}
+	return v
+}
@@ -0,0 +1,178 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bloatcheck
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	now := time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)
+	p := &Policy{
+		Limits: []Limit{
+			{Bundles: "os-core", MaxPercent: 10, Level: LevelFail},
+			{Bundles: "kernel-*", MaxBytes: 1000, Level: LevelFail},
+			{Bundles: "*", MaxPercent: 20, Level: LevelWarn},
+		},
+		Exemptions: []Exemption{
+			{Bundles: "kernel-native", Expires: now.AddDate(0, 0, 1), Reason: "firmware"},
+			{Bundles: "kernel-lts", Expires: now.AddDate(0, 0, -1), Reason: "firmware"},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		bundle   string
+		from, to int64
+		level    string
+		exceeded int
+		exempt   bool
+		expired  bool
+	}{
+		{"within limits", "os-core", 1000, 1050, LevelPass, 0, false, false},
+		{"shrunk", "editors", 1000, 500, LevelPass, 0, false, false},
+		{"fail percent", "os-core", 1000, 1150, LevelFail, 1, false, false},
+		{"fail and warn", "os-core", 1000, 1300, LevelFail, 2, false, false},
+		{"warn only", "editors", 1000, 1300, LevelWarn, 1, false, false},
+		{"fail bytes", "kernel-kvm", 100000, 102000, LevelFail, 1, false, false},
+		{"new bundle content", "editors", 0, 1000, LevelPass, 0, false, false},
+		{"exempt", "kernel-native", 100000, 102000, LevelPass, 1, true, false},
+		{"expired exemption", "kernel-lts", 100000, 102000, LevelFail, 1, false, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v := p.Check(tc.bundle, tc.from, tc.to, now)
+			if v.Level != tc.level {
+				t.Errorf("expected level %s but got %s", tc.level, v.Level)
+			}
+			if len(v.Exceeded) != tc.exceeded {
+				t.Errorf("expected %d exceeded limits but got %v", tc.exceeded, v.Exceeded)
+			}
+			if (v.Exemption != nil) != tc.exempt {
+				t.Errorf("expected exempt %v but got %v", tc.exempt, v.Exemption)
+			}
+			if (v.Expired != nil) != tc.expired {
+				t.Errorf("expected expired %v but got %v", tc.expired, v.Expired)
+			}
+		})
+	}
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	p := DefaultPolicy(10, 20)
+	now := time.Now()
+	if v := p.Check("os-core", 100, 115, now); v.Level != LevelFail {
+		t.Errorf("expected os-core to fail at 15%% but got %s", v.Level)
+	}
+	if v := p.Check("editors", 100, 115, now); v.Level != LevelPass {
+		t.Errorf("expected editors to pass at 15%% but got %s", v.Level)
+	}
+	if v := p.Check("editors", 100, 125, now); v.Level != LevelWarn {
+		t.Errorf("expected editors to warn at 25%% but got %s", v.Level)
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{"valid", `
+[[limit]]
+  bundles = "os-core*"
+  max_percent = 10.0
+  level = "fail"
+
+[[limit]]
+  bundles = "*"
+  max_bytes = 1048576
+  level = "warn"
+
+[[exemption]]
+  bundles = "kernel-native"
+  expires = 2019-01-31
+  reason = "firmware is split out next release"
+`, true},
+		{"bad level", `
+[[limit]]
+  bundles = "*"
+  max_percent = 10.0
+  level = "error"
+`, false},
+		{"no cap", `
+[[limit]]
+  bundles = "*"
+  level = "warn"
+`, false},
+		{"bad glob", `
+[[limit]]
+  bundles = "os-core["
+  max_percent = 10.0
+  level = "warn"
+`, false},
+		{"no expiry", `
+[[exemption]]
+  bundles = "kernel-native"
+  reason = "firmware"
+`, false},
+		{"no reason", `
+[[exemption]]
+  bundles = "kernel-native"
+  expires = 2019-01-31
+`, false},
+		{"unknown key", `
+[[limit]]
+  bundles = "*"
+  max_precent = 10.0
+  level = "warn"
+`, false},
+	}
+
+	dir, err := ioutil.TempDir("", "bloat-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, "policy.toml")
+			if err := ioutil.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			p, err := LoadPolicy(path)
+			if (err == nil) != tc.valid {
+				t.Fatalf("expected valid %v but got error %v", tc.valid, err)
+			}
+			if !tc.valid {
+				return
+			}
+			if len(p.Limits) != 2 || len(p.Exemptions) != 1 {
+				t.Fatalf("expected 2 limits and 1 exemption but got %+v", p)
+			}
+			if p.Exemptions[0].Expires.Year() != 2019 {
+				t.Errorf("expected expiry in 2019 but got %v", p.Exemptions[0].Expires)
+			}
+		})
+	}
+}
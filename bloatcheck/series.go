@@ -0,0 +1,136 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bloatcheck
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/clearlinux/diva/diva"
+	"github.com/clearlinux/diva/internal/helpers"
+	"github.com/clearlinux/mixer-tools/swupd"
+)
+
+// SizePoint is the size of every bundle in a single build of a series
+type SizePoint struct {
+	Version string
+	Sizes   map[string]BundleSize
+}
+
+// ParseRange parses a version range of the form <from>..<to>
+func ParseRange(r string) (uint, uint, error) {
+	parts := strings.Split(r, "..")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid range %q, expected <from>..<to>", r)
+	}
+
+	var versions [2]uint
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid range %q: %v", r, err)
+		}
+		versions[i] = uint(v)
+	}
+	if versions[0] > versions[1] {
+		return 0, 0, fmt.Errorf("invalid range %q, %d is newer than %d", r, versions[0], versions[1])
+	}
+	return versions[0], versions[1], nil
+}
+
+// pickSteps returns every step-th version of the ascending versions, always
+// including the first and the last
+func pickSteps(versions []uint, step int) []uint {
+	if step < 1 {
+		step = 1
+	}
+
+	var picked []uint
+	for i := 0; i < len(versions); i += step {
+		picked = append(picked, versions[i])
+	}
+	if len(versions) > 0 && picked[len(picked)-1] != versions[len(versions)-1] {
+		picked = append(picked, versions[len(versions)-1])
+	}
+	return picked
+}
+
+// ReleaseSeries returns every step-th build from the from to the to version,
+// oldest first. Builds are found by following the previous version recorded
+// in the MoM of each build, starting at to, so versions that were never
+// released are skipped. The MoMs are downloaded to the cache as needed.
+func ReleaseSeries(u diva.UInfo, from, to uint, step int) ([]uint, error) {
+	baseCache := filepath.Join(u.CacheLoc, "update")
+
+	var versions []uint
+	for v := to; v >= from && v > 0; {
+		versions = append(versions, v)
+
+		momPath := filepath.Join(baseCache, fmt.Sprint(v), "Manifest.MoM")
+		if err := helpers.DownloadManifest(u.URL, fmt.Sprint(v), "MoM", momPath); err != nil {
+			return nil, err
+		}
+		mom, err := swupd.ParseManifestFile(momPath)
+		if err != nil {
+			return nil, err
+		}
+		if uint(mom.Header.Previous) >= v {
+			return nil, fmt.Errorf("MoM of %d lists %d as its previous version", v, mom.Header.Previous)
+		}
+		v = uint(mom.Header.Previous)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] < versions[j]
+	})
+	return pickSteps(versions, step), nil
+}
+
+// WriteSeriesCSV writes the series as CSV with a version, bundle, installed
+// and unique size column, and one row per bundle of every build
+func WriteSeriesCSV(w io.Writer, series []SizePoint) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"version", "bundle", "installed", "unique"}); err != nil {
+		return err
+	}
+
+	for _, p := range series {
+		var bundles []string
+		for b := range p.Sizes {
+			bundles = append(bundles, b)
+		}
+		sort.Strings(bundles)
+
+		for _, b := range bundles {
+			err := cw.Write([]string{
+				p.Version,
+				b,
+				fmt.Sprint(p.Sizes[b].Installed),
+				fmt.Sprint(p.Sizes[b].Unique),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
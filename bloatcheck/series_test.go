@@ -0,0 +1,91 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bloatcheck
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	testCases := []struct {
+		r        string
+		from, to uint
+		valid    bool
+	}{
+		{"26000..26100", 26000, 26100, true},
+		{"26000..26000", 26000, 26000, true},
+		{"26100..26000", 0, 0, false},
+		{"26000-26100", 0, 0, false},
+		{"latest..26100", 0, 0, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.r, func(t *testing.T) {
+			from, to, err := ParseRange(tc.r)
+			if (err == nil) != tc.valid {
+				t.Fatalf("expected valid %v but got error %v", tc.valid, err)
+			}
+			if from != tc.from || to != tc.to {
+				t.Errorf("expected %d..%d but got %d..%d", tc.from, tc.to, from, to)
+			}
+		})
+	}
+}
+
+func TestPickSteps(t *testing.T) {
+	versions := []uint{10, 20, 30, 40, 50}
+	testCases := []struct {
+		step     int
+		expected []uint
+	}{
+		{1, []uint{10, 20, 30, 40, 50}},
+		{2, []uint{10, 30, 50}},
+		{3, []uint{10, 40, 50}},
+		{10, []uint{10, 50}},
+	}
+
+	for _, tc := range testCases {
+		if got := pickSteps(versions, tc.step); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("step %d: expected %v but got %v", tc.step, tc.expected, got)
+		}
+	}
+}
+
+func TestWriteSeriesCSV(t *testing.T) {
+	series := []SizePoint{
+		{Version: "10", Sizes: map[string]BundleSize{
+			"os-core": {Installed: 100, Unique: 100},
+			"editors": {Installed: 150, Unique: 50},
+		}},
+		{Version: "20", Sizes: map[string]BundleSize{
+			"os-core": {Installed: 110, Unique: 110},
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSeriesCSV(&buf, series); err != nil {
+		t.Fatal(err)
+	}
+	expected := `version,bundle,installed,unique
+10,editors,150,50
+10,os-core,100,100
+20,os-core,110,110
+`
+	if buf.String() != expected {
+		t.Errorf("expected\n%s\nbut got\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/clearlinux/diva/pkginfo"
+)
+
+// packageBundles maps each package to the sorted names of the bundles that
+// directly include it
+func packageBundles(bundles Set) map[string][]string {
+	pkgBundles := make(map[string][]string)
+	for name, b := range bundles {
+		for pkg := range b.DirectPackages {
+			pkgBundles[pkg] = append(pkgBundles[pkg], name)
+		}
+	}
+	for pkg := range pkgBundles {
+		sort.Strings(pkgBundles[pkg])
+	}
+	return pkgBundles
+}
+
+// outsideDeps returns a description of each requirement of the direct
+// packages of b that is satisfied in the repo, but not by any package in the
+// include closure of b. Packages missing from the repo are reported by the
+// bundles check and are skipped here.
+func outsideDeps(b *Definition, rpms map[string]*pkginfo.RPM, idx *pkginfo.ProvidesIndex, pkgBundles map[string][]string) []string {
+	var failures []string
+	for pkg := range b.DirectPackages {
+		r, ok := rpms[pkg]
+		if !ok {
+			continue
+		}
+
+	requires:
+		for _, req := range r.Requires {
+			providers := idx.WhatProvides(req)
+			if len(providers) == 0 {
+				continue
+			}
+
+			var names []string
+			for _, p := range providers {
+				if b.AllPackages[p.Name] {
+					continue requires
+				}
+				names = append(names, p.Name)
+			}
+			sort.Strings(names)
+
+			var where []string
+			for _, name := range names {
+				if bs, ok := pkgBundles[name]; ok {
+					where = append(where, fmt.Sprintf("%s (%s)", name, strings.Join(bs, ", ")))
+				} else {
+					where = append(where, fmt.Sprintf("%s (no bundle)", name))
+				}
+			}
+			failures = append(failures, fmt.Sprintf("%s requires %s, provided by %s",
+				pkg, req, strings.Join(where, "; ")))
+		}
+	}
+	sort.Strings(failures)
+	return failures
+}
+
+// OutsideDeps returns, for every bundle in checked, a description of each
+// requirement of its direct packages that repo satisfies only with packages
+// outside of the include closure of the bundle, naming the bundles in bundles
+// that would satisfy it. Requirements that nothing in repo satisfies are left
+// to pkginfo.UnresolvedRequires.
+func OutsideDeps(repo *pkginfo.Repo, bundles, checked Set) map[string][]string {
+	rpms := make(map[string]*pkginfo.RPM)
+	for _, r := range repo.Packages {
+		rpms[r.Name] = r
+	}
+	idx := pkginfo.NewProvidesIndex(repo)
+	pkgBundles := packageBundles(bundles)
+
+	deps := make(map[string][]string)
+	for name, b := range checked {
+		deps[name] = outsideDeps(b, rpms, idx, pkgBundles)
+	}
+	return deps
+}
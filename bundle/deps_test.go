@@ -0,0 +1,95 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/clearlinux/diva/pkginfo"
+)
+
+func TestOutsideDeps(t *testing.T) {
+	bundles := Set{
+		"os-core": {
+			Name:           "os-core",
+			DirectPackages: map[string]bool{"glibc": true, "bash": true},
+			AllPackages:    map[string]bool{"glibc": true, "bash": true},
+		},
+		"editors": {
+			Name:           "editors",
+			Includes:       map[string]bool{"os-core": true},
+			DirectPackages: map[string]bool{"vim": true},
+			AllPackages:    map[string]bool{"vim": true, "glibc": true, "bash": true},
+		},
+		"python-basic": {
+			Name:           "python-basic",
+			Includes:       map[string]bool{"os-core": true},
+			DirectPackages: map[string]bool{"python3": true},
+			AllPackages:    map[string]bool{"python3": true, "glibc": true, "bash": true},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		req      pkginfo.Dependency
+		expected []string
+	}{
+		{"satisfied in include", pkginfo.Dependency{Name: "libc.so.6()(64bit)"}, nil},
+		{"satisfied by other bundle", pkginfo.Dependency{Name: "python3"},
+			[]string{"vim requires python3, provided by python3 (python-basic)"}},
+		{"file path in include", pkginfo.Dependency{Name: "/usr/bin/sh"}, nil},
+		{"file path outside bundles", pkginfo.Dependency{Name: "/usr/bin/perl"},
+			[]string{"vim requires /usr/bin/perl, provided by perl (no bundle)"}},
+		{"unresolved", pkginfo.Dependency{Name: "libmissing.so.1()(64bit)"}, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &pkginfo.Repo{
+				Packages: []*pkginfo.RPM{
+					{Name: "glibc", Provides: []pkginfo.Dependency{{Name: "libc.so.6()(64bit)"}}},
+					{Name: "bash", Files: []*pkginfo.File{{Name: "/usr/bin/sh", Type: 'F'}}},
+					{Name: "python3", Provides: []pkginfo.Dependency{{Name: "python3"}}},
+					{Name: "perl", Files: []*pkginfo.File{{Name: "/usr/bin/perl", Type: 'F'}}},
+					{Name: "vim", Requires: []pkginfo.Dependency{tc.req}},
+				},
+			}
+
+			deps := OutsideDeps(repo, bundles, Set{"editors": bundles["editors"]})
+			if len(deps) != 1 {
+				t.Fatalf("expected results for 1 bundle but got %v", deps)
+			}
+			if !reflect.DeepEqual(deps["editors"], tc.expected) {
+				t.Errorf("expected %v but got %v", tc.expected, deps["editors"])
+			}
+		})
+	}
+}
+
+func TestPackageBundles(t *testing.T) {
+	bundles := Set{
+		"b": {DirectPackages: map[string]bool{"shared": true, "only-b": true}},
+		"a": {DirectPackages: map[string]bool{"shared": true}},
+	}
+
+	expected := map[string][]string{
+		"shared": {"a", "b"},
+		"only-b": {"b"},
+	}
+	if got := packageBundles(bundles); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v but got %v", expected, got)
+	}
+}
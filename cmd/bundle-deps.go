@@ -0,0 +1,112 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/clearlinux/diva/bundle"
+	"github.com/clearlinux/diva/diva"
+	"github.com/clearlinux/diva/internal/helpers"
+	"github.com/clearlinux/diva/pkginfo"
+	"github.com/spf13/cobra"
+)
+
+type bundleDepsCmdFlags struct {
+	repoName string
+	version  string
+	bundle   string
+}
+
+var bundleDepsFlags bundleDepsCmdFlags
+
+func init() {
+	checkCmd.AddCommand(bundleDepsCmd)
+	bundleDepsCmd.Flags().StringVarP(&bundleDepsFlags.repoName, "reponame", "n", "clear", "Name of repo")
+	bundleDepsCmd.Flags().StringVarP(&bundleDepsFlags.version, "version", "v", "0", "Version to check")
+	bundleDepsCmd.Flags().StringVarP(&bundleDepsFlags.bundle, "bundle", "b", "", "Bundle to check")
+}
+
+var bundleDepsCmd = &cobra.Command{
+	Use:   "bundle-deps",
+	Short: "Check that bundle package requirements are satisfied within each bundle",
+	Long: `Check that the runtime requirements of the packages in each bundle are
+satisfied by packages within that bundle's include closure, which always
+contains os-core. Requirements that can only be satisfied by packages outside
+the bundle are reported along with the bundles that would satisfy them.
+Requirements that no package in the repo satisfies are left to "diva check
+deps". For a <bundle> or the default of all bundles. An optional <reponame>
+and <version> may be used to specify the repo to check against with "clear"
+and "0" as the defaults.`,
+	Run: runCheckBundleDeps,
+}
+
+func runCheckBundleDeps(cmd *cobra.Command, args []string) {
+	repo := pkginfo.Repo{
+		Name:    bundleDepsFlags.repoName,
+		Version: bundleDepsFlags.version,
+		Type:    "B",
+	}
+
+	db, closeStore := openStore()
+	defer closeStore()
+
+	helpers.PrintBegin("Populating repo")
+	err := pkginfo.PopulateRepo(db, &repo, conf.Paths.CacheLocation)
+	helpers.FailIfErr(err)
+	helpers.PrintComplete("Repo populated successfully")
+
+	err = diva.GetLatestBundles(conf, "")
+	helpers.FailIfErr(err)
+
+	// all bundles are always read so requirements satisfied outside the
+	// checked bundle can name the bundles that satisfy them
+	bundles, err := bundle.GetAll(conf.Paths.BundleDefsRepo)
+	helpers.FailIfErr(err)
+
+	checked := bundles
+	if bundleDepsFlags.bundle != "" {
+		b, ok := bundles[bundleDepsFlags.bundle]
+		if !ok {
+			helpers.FailIfErr(fmt.Errorf("%s is neither a pundle nor a bundle", bundleDepsFlags.bundle))
+		}
+		checked = bundle.Set{bundleDepsFlags.bundle: b}
+	}
+
+	result := newSuite("bundle-deps", "validate bundle dependency completeness")
+	checkBundleDeps(&repo, bundles, checked, result)
+
+	finishSuite(result)
+}
+
+func checkBundleDeps(repo *pkginfo.Repo, bundles, checked bundle.Set, result *diva.Results) {
+	deps := bundle.OutsideDeps(repo, bundles, checked)
+
+	var names []string
+	for name := range checked {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		failures := deps[name]
+		result.Ok(len(failures) == 0, fmt.Sprintf("%s requirements satisfied within bundle", name))
+		if len(failures) > 0 {
+			result.Diagnostic("requirements satisfied outside bundle:\n" + strings.Join(failures, "\n"))
+		}
+	}
+}
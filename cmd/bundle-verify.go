@@ -17,7 +17,6 @@ package cmd
 import (
 	"bufio"
 	"fmt"
-	"os"
 	"regexp"
 	"strings"
 
@@ -65,29 +64,30 @@ func runVerifyBundle(cmd *cobra.Command, args []string) {
 		Type:    "B",
 	}
 
+	db, closeStore := openStore()
+	defer closeStore()
+
 	helpers.PrintBegin("Populating repo")
-	err := pkginfo.PopulateRepo(&repo, conf.Paths.CacheLocation)
+	err := pkginfo.PopulateRepo(db, &repo, conf.Paths.CacheLocation)
 	helpers.FailIfErr(err)
 	helpers.PrintComplete("Repo populated successfully")
 
 	err = diva.GetLatestBundles(conf, "")
 	helpers.FailIfErr(err)
 
-	result := diva.NewSuite("bundle-verify", "validate bundle correctness")
+	result := newSuite("bundle-verify", "validate bundle correctness")
 	bundles, err := checkAndGetBundleDefinitions(result)
 	helpers.FailIfErr(err)
 
 	checkBundleHeaderTitleMatchesFile(bundles, result)
 
-	err = checkBundleComplete(&repo, bundles, result)
+	err = checkBundleComplete(db, &repo, bundles, result)
 	helpers.FailIfErr(err)
 
 	err = checkIfPundleDeletesExist(result)
 	helpers.FailIfErr(err)
 
-	if result.Failed > 0 {
-		os.Exit(1)
-	}
+	finishSuite(result)
 }
 
 func checkAndGetBundleDefinitions(result *diva.Results) (bundle.Set, error) {
@@ -122,14 +122,14 @@ func checkBundleHeaderTitleMatchesFile(bundles bundle.Set, result *diva.Results)
 	}
 }
 
-func checkBundleComplete(repo *pkginfo.Repo, bundles bundle.Set, result *diva.Results) error {
+func checkBundleComplete(db pkginfo.Store, repo *pkginfo.Repo, bundles bundle.Set, result *diva.Results) error {
 	var err error
 	var rpm *pkginfo.RPM
 	var failures []string
 
 	for _, bundle := range bundles {
 		for pkg := range bundle.DirectPackages {
-			rpm, err = pkginfo.GetRPM(repo, pkg)
+			rpm, err = pkginfo.GetRPM(db, repo, pkg)
 			if rpm == nil || err != nil {
 				failures = append(failures, fmt.Sprintf("%s from bundle %s", pkg, bundle.Name))
 			}
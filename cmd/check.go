@@ -16,48 +16,159 @@ package cmd
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/clearlinux/diva/bloatcheck"
 	"github.com/clearlinux/diva/diva"
 	"github.com/clearlinux/diva/internal/helpers"
+	"github.com/clearlinux/diva/pkginfo"
 	"github.com/spf13/cobra"
 )
 
-var highPrioBundles = map[string]bool{"os-core": true, "os-core-update": true, "c-basic": true, "kernel": true}
-
 type bloatCheckCmdFlags struct {
-	printOutput bool
-	failCap     float64
-	warningCap  float64
+	printOutput  bool
+	failCap      float64
+	warningCap   float64
+	top          int
+	jsonPath     string
+	repoName     string
+	versionRange string
+	step         int
+	seriesPath   string
+	seriesFormat string
+	policyPath   string
+	download     bool
 }
 
 var bloatFlags bloatCheckCmdFlags
 
+type checkCmdFlags struct {
+	output  string
+	strict  bool
+	waivers string
+}
+
+var checkFlags checkCmdFlags
+
+// waivers are the accepted failures of every check suite
+var waivers []diva.Waiver
+
 var checkCmd = &cobra.Command{
 	Use:   "check",
 	Short: "Run various content and metadata checks",
-	Long:  `Run various checks against distribution content or metadata`,
-}
+	Long: `Run various checks against distribution content or metadata. The results
+are printed as TAP while the checks run unless --output selects json, junit or
+markdown, which are printed once every check completed. Checks may report
+warnings, which do not fail the run unless --strict is passed. TAP has no
+warnings, a warning passes there with a "warning:" diagnostic and is only
+reported as such in the json, junit and markdown output.
+
+Known failures are waived by the waivers file in the [paths] section of the
+configuration, or the file passed with --waivers. Each [[waiver]] entry names
+the suite, either the test description or a regular expression pattern
+matching it, the expiry date, the reason and optionally a ticket. Waived
+failures are reported as waived and do not fail the run, while expired waivers
+fail it. The suite of each check is named after its command, except for
+"diva check bundles" whose suite is bundle-verify:
+
+  bloat, bundle-deps, bundle-verify, deps, file-conflicts, manifest-content,
+  pydeps, repo-integrity, signatures, updatecontent, version-regression`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		switch checkFlags.output {
+		case "tap", "json", "junit", "markdown":
+		default:
+			return fmt.Errorf("unknown output format %s", checkFlags.output)
+		}
 
-func checkSize(name *string, sizeDiff, size float64) (float64, bool) {
-	if _, ok := highPrioBundles[*name]; ok {
-		// High priority bundles cannot increase by more than 10% because they
-		// may affect many other bundles and minimal installations -> error out
-		sizeChange := size * (bloatFlags.failCap / 100.0)
-		if sizeDiff > sizeChange {
-			return sizeDiff, true
+		path := checkFlags.waivers
+		if path == "" {
+			path = conf.Paths.Waivers
 		}
+		if path == "" {
+			return nil
+		}
+		var err error
+		waivers, err = diva.LoadWaivers(path)
+		return err
+	},
+}
+
+// newSuite returns a new test suite printing TAP as the tests run only when
+// TAP output was asked for
+func newSuite(name, desc string) *diva.Results {
+	r := diva.NewSuite(name, desc)
+	r.Strict = checkFlags.strict
+	r.Waivers = waivers
+	if checkFlags.output != "tap" {
+		r.Writer = ioutil.Discard
 	}
-	// Increase of warning cap needs to be flagged, but not fatal
-	sizeChange := size * (bloatFlags.warningCap / 100.0)
-	if sizeDiff > sizeChange {
-		return sizeDiff, true
+	return r
+}
+
+// finishSuite checks the waivers of r, prints its results in the output
+// format and exits with an error code if any test failed
+func finishSuite(r *diva.Results) {
+	r.CheckWaivers()
+	helpers.FailIfErr(r.Print(os.Stdout, checkFlags.output))
+	if r.Failed > 0 {
+		helpers.Exit(1)
 	}
-	return 0, false
 }
 
-func runBloatCheck(r *diva.Results, u diva.UInfo, args []string) error {
+// loadBloatPolicy returns the policy file passed with --policy or set in the
+// configuration, or the default policy built from --max and --warn
+func loadBloatPolicy() (*bloatcheck.Policy, error) {
+	path := bloatFlags.policyPath
+	if path == "" {
+		path = conf.Paths.BloatPolicy
+	}
+	if path == "" {
+		return bloatcheck.DefaultPolicy(bloatFlags.failCap, bloatFlags.warningCap), nil
+	}
+	return bloatcheck.LoadPolicy(path)
+}
+
+// checkBundleSize checks the change of the size of bundle from fromSize to
+// toSize against policy and returns the verdict along with a test description.
+// kind names the size being checked in the description.
+func checkBundleSize(policy *bloatcheck.Policy, bundle, kind string, fromSize, toSize int64) (bloatcheck.Verdict, string) {
+	v := policy.Check(bundle, fromSize, toSize, time.Now())
+	change := fmt.Sprintf("%+d bytes", toSize-fromSize)
+	if fromSize > 0 {
+		change = fmt.Sprintf("%3.2f%%", float64(toSize-fromSize)/float64(fromSize)*100)
+	}
+	return v, fmt.Sprintf("%s %s did not grow past its limits -> %s", bundle, kind, change)
+}
+
+// reportBundleSize records the verdict of a bundle size check. Only bundles
+// that grew past a fail limit fail the test, bundles that grew past a warn
+// limit warn and exempted bundles pass with a diagnostic.
+func reportBundleSize(r *diva.Results, v bloatcheck.Verdict, desc string) {
+	switch {
+	case v.Exemption != nil:
+		r.Ok(true, desc)
+		r.Diagnostic(fmt.Sprintf("exempt until %s: %s\n%s",
+			v.Exemption.Expires.Format("2006-01-02"), v.Exemption.Reason, strings.Join(v.Exceeded, "\n")))
+	case v.Level == bloatcheck.LevelWarn:
+		r.Warn(desc)
+		r.Diagnostic(strings.Join(v.Exceeded, "\n"))
+	case v.Level == bloatcheck.LevelFail:
+		r.Ok(false, desc)
+		r.Diagnostic(strings.Join(v.Exceeded, "\n"))
+	default:
+		r.Ok(true, desc)
+	}
+	if v.Expired != nil {
+		r.Diagnostic(fmt.Sprintf("exemption expired on %s: %s",
+			v.Expired.Expires.Format("2006-01-02"), v.Expired.Reason))
+	}
+}
+
+func runBloatCheck(r *diva.Results, u diva.UInfo, policy *bloatcheck.Policy, args []string) error {
 	var err error
 
 	// Get the smallest version # passed in if it's not in order
@@ -82,14 +193,22 @@ func runBloatCheck(r *diva.Results, u diva.UInfo, args []string) error {
 	}
 
 	if len(args) == 1 {
-		fmt.Printf("Size information for build %v\n", u.Ver)
-		for bundle, size := range fromBundleSizes {
-			fmt.Printf("%s: %d\n", bundle, size)
+		var bundles []string
+		for bundle := range fromBundleSizes {
+			bundles = append(bundles, bundle)
+		}
+		sort.Strings(bundles)
+		r.Diagnostic(fmt.Sprintf("Size information for build %v", u.Ver))
+		for _, bundle := range bundles {
+			size := fromBundleSizes[bundle]
+			r.Diagnostic(fmt.Sprintf("%s: %d (%d unique)", bundle, size.Installed, size.Unique))
 		}
 		// exit so we don't try to compare build sizes
 		return nil
 	}
 
+	fromU := u
+
 	// Get the larger of the two if it's out of order
 	u.Ver = helpers.Max(args[0], args[1])
 
@@ -109,55 +228,363 @@ func runBloatCheck(r *diva.Results, u diva.UInfo, args []string) error {
 	}
 
 	// Iterate using from because to may have new bundles
-	var sizeDiff int64
-	var desc string
-	for bundle, size := range fromBundleSizes {
-		if _, ok := toBundleSizes[bundle]; !ok {
-			continue
+	var bundles, flagged []string
+	for bundle := range fromBundleSizes {
+		if _, ok := toBundleSizes[bundle]; ok {
+			bundles = append(bundles, bundle)
+		}
+	}
+	sort.Strings(bundles)
+
+	descs := make(map[string]string)
+	verdicts := make(map[string]bloatcheck.Verdict)
+	for _, bundle := range bundles {
+		v, desc := checkBundleSize(policy, bundle, "size", fromBundleSizes[bundle].Installed, toBundleSizes[bundle].Installed)
+		descs[bundle] = desc
+		verdicts[bundle] = v
+		if v.Level != bloatcheck.LevelPass {
+			flagged = append(flagged, bundle)
 		}
-		sizeDiff = toBundleSizes[bundle] - size
-		changeCap := bloatFlags.warningCap
-		_, ret := checkSize(&bundle, float64(sizeDiff), float64(size))
+	}
 
-		percentDiff := (float64(toBundleSizes[bundle]) - float64(fromBundleSizes[bundle])) / float64(fromBundleSizes[bundle]) * 100
-		pChange := fmt.Sprintf("%3.2f%%", percentDiff)
-		if _, ok := highPrioBundles[bundle]; ok {
-			changeCap = bloatFlags.failCap
+	var attributions map[string]bloatcheck.Attribution
+	if len(flagged) > 0 && (bloatFlags.printOutput || bloatFlags.jsonPath != "") {
+		attributions, err = attributeBloat(fromU, u, flagged)
+		if err != nil {
+			return err
 		}
-		desc = fmt.Sprintf("%s size did not change by more than %2.0f%% -> %s", bundle, changeCap, pChange)
-		r.Ok(!ret, desc)
+	}
+
+	for _, bundle := range bundles {
+		reportBundleSize(r, verdicts[bundle], descs[bundle])
+		if a, ok := attributions[bundle]; ok && bloatFlags.printOutput {
+			r.Diagnostic(a.String())
+		}
+	}
+
+	if bloatFlags.jsonPath != "" {
+		var out []bloatcheck.Attribution
+		for _, bundle := range flagged {
+			out = append(out, attributions[bundle])
+		}
+		return writeJSON(bloatFlags.jsonPath, out)
 	}
 	return nil
 }
 
+// runBloatDownload checks the change of the download size of a fresh install
+// of every bundle between two builds, and reports the download size of
+// updating each bundle from one build to the other. With a single build it
+// prints the fresh install download size of every bundle.
+func runBloatDownload(r *diva.Results, u diva.UInfo, policy *bloatcheck.Policy, args []string) error {
+	versions := []string{args[0]}
+	if len(args) == 2 {
+		versions = []string{helpers.Min(args[0], args[1]), helpers.Max(args[0], args[1])}
+	}
+
+	size := bloatcheck.RemoteSizes(u)
+	var infos []diva.UInfo
+	var sizes []map[string]int64
+	for _, v := range versions {
+		u.Ver = v
+		if err := diva.GetBundleAtTag(conf, allFlags.bundleURL, u.Ver); err != nil {
+			return err
+		}
+		if err := diva.FetchUpdate(u); err != nil {
+			return err
+		}
+
+		helpers.PrintBegin("measuring packs and fullfiles of version %v", u.Ver)
+		s, err := bloatcheck.GetDownloadSizes(u, conf.Paths.BundleDefsRepo, size)
+		if err != nil {
+			return err
+		}
+		helpers.PrintComplete("measured %d bundles", len(s))
+		infos = append(infos, u)
+		sizes = append(sizes, s)
+	}
+
+	if len(versions) == 1 {
+		var bundles []string
+		for bundle := range sizes[0] {
+			bundles = append(bundles, bundle)
+		}
+		sort.Strings(bundles)
+		r.Diagnostic(fmt.Sprintf("Download size information for build %v", u.Ver))
+		for _, bundle := range bundles {
+			r.Diagnostic(fmt.Sprintf("%s: %d", bundle, sizes[0][bundle]))
+		}
+		return nil
+	}
+
+	upgrades, err := bloatcheck.GetUpgradeSizes(infos[0], infos[1], size)
+	if err != nil {
+		return err
+	}
+
+	var bundles []string
+	for bundle := range sizes[0] {
+		if _, ok := sizes[1][bundle]; ok {
+			bundles = append(bundles, bundle)
+		}
+	}
+	sort.Strings(bundles)
+
+	for _, bundle := range bundles {
+		v, desc := checkBundleSize(policy, bundle, "download size", sizes[0][bundle], sizes[1][bundle])
+		reportBundleSize(r, v, desc)
+		up, ok := upgrades[bundle]
+		switch {
+		case !ok || up == bloatcheck.Upgrade{}:
+			continue
+		case up.DeltaPack:
+			r.Diagnostic(fmt.Sprintf("update from %s: %d bytes delta pack", versions[0], up.Size))
+		default:
+			r.Diagnostic(fmt.Sprintf("update from %s: %d bytes of fullfiles, no delta pack", versions[0], up.Size))
+		}
+	}
+	return nil
+}
+
+// runBloatRange checks the cumulative size change of every bundle over a
+// series of builds, so that slow growth over many builds is flagged even when
+// no single build grows a bundle past its limits
+func runBloatRange(r *diva.Results, u diva.UInfo, policy *bloatcheck.Policy) error {
+	from, to, err := bloatcheck.ParseRange(bloatFlags.versionRange)
+	if err != nil {
+		return err
+	}
+	versions, err := bloatcheck.ReleaseSeries(u, from, to, bloatFlags.step)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return fmt.Errorf("no builds found from %d to %d", from, to)
+	}
+
+	var series []bloatcheck.SizePoint
+	for _, v := range versions {
+		u.Ver = fmt.Sprint(v)
+		if err = diva.GetBundleAtTag(conf, allFlags.bundleURL, u.Ver); err != nil {
+			return err
+		}
+		if err = diva.FetchUpdate(u); err != nil {
+			return err
+		}
+
+		sizes, err := bloatcheck.GetBundleSize(u, conf.Paths.BundleDefsRepo)
+		if err != nil {
+			return err
+		}
+		series = append(series, bloatcheck.SizePoint{Version: u.Ver, Sizes: sizes})
+	}
+
+	first, last := series[0], series[len(series)-1]
+	var bundles []string
+	for bundle := range first.Sizes {
+		if _, ok := last.Sizes[bundle]; ok {
+			bundles = append(bundles, bundle)
+		}
+	}
+	sort.Strings(bundles)
+
+	for _, bundle := range bundles {
+		v, desc := checkBundleSize(policy, bundle, "size", first.Sizes[bundle].Installed, last.Sizes[bundle].Installed)
+		reportBundleSize(r, v, fmt.Sprintf("%s from %s to %s", desc, first.Version, last.Version))
+		if v.Level != bloatcheck.LevelPass {
+			var steps []string
+			for _, p := range series {
+				if size, ok := p.Sizes[bundle]; ok {
+					steps = append(steps, fmt.Sprintf("%s: %d", p.Version, size.Installed))
+				}
+			}
+			r.Diagnostic("size per build:\n" + strings.Join(steps, "\n"))
+		}
+	}
+
+	if bloatFlags.seriesPath == "" {
+		return nil
+	}
+	switch bloatFlags.seriesFormat {
+	case "csv":
+		f, err := os.Create(bloatFlags.seriesPath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		return bloatcheck.WriteSeriesCSV(f, series)
+	case "json":
+		return writeJSON(bloatFlags.seriesPath, series)
+	}
+	return fmt.Errorf("unknown series format %s", bloatFlags.seriesFormat)
+}
+
+// attributeBloat explains the size change of each of the bundles between the
+// from and to builds. Changed files are attributed to the source packages
+// that ship them in the repos of the same versions, if they were fetched.
+func attributeBloat(from, to diva.UInfo, bundles []string) (map[string]bloatcheck.Attribution, error) {
+	err := diva.GetBundleAtTag(conf, allFlags.bundleURL, from.Ver)
+	if err != nil {
+		return nil, err
+	}
+	fromFiles, err := bloatcheck.GetBundleFiles(from, conf.Paths.BundleDefsRepo, bundles)
+	if err != nil {
+		return nil, err
+	}
+
+	err = diva.GetBundleAtTag(conf, allFlags.bundleURL, to.Ver)
+	if err != nil {
+		return nil, err
+	}
+	toFiles, err := bloatcheck.GetBundleFiles(to, conf.Paths.BundleDefsRepo, bundles)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := pkginfo.OpenStore(conf)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	// prefer the owner in the newer repo, deleted files are only in the older
+	var repos []*pkginfo.Repo
+	for _, v := range []string{to.Ver, from.Ver} {
+		repos = append(repos, &pkginfo.Repo{Name: bloatFlags.repoName, Version: v, Type: "B"})
+	}
+	owners := make(map[string]string)
+	owner := func(path string) string {
+		if o, ok := owners[path]; ok {
+			return o
+		}
+		for _, repo := range repos {
+			names, err := pkginfo.WhatOwns(db, repo, path)
+			if err != nil || len(names) == 0 {
+				continue
+			}
+			owners[path] = names[0]
+			if srpm, err := pkginfo.GetSRPMName(db, repo, names[0]); err == nil && srpm != "" {
+				owners[path] = srpm
+			}
+			break
+		}
+		return owners[path]
+	}
+
+	attributions := make(map[string]bloatcheck.Attribution)
+	for _, bundle := range bundles {
+		attributions[bundle] = bloatcheck.AttributeSizeChange(
+			bundle, fromFiles[bundle], toFiles[bundle], owner, bloatFlags.top)
+	}
+	return attributions, nil
+}
+
+// writeJSON writes v as indented JSON to the file at path
+func writeJSON(path string, v interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	return printJSON(f, v)
+}
+
 var bloatCheckCmd = &cobra.Command{
-	Use:   "bloat [version] <to version>",
+	Use:   "bloat [version] <to version> | --range <from>..<to>",
 	Short: "Check bundle size variation between builds",
 	Long: `Check bundle size variation between 2 builds by supplying two
 versions (to & from). You can omit the second "to version" to get the size
-of every bundle from one build only`,
-	Args: cobra.MinimumNArgs(1),
+of every bundle from one build only. The size of a bundle is the installed
+size of the bundle and its includes, counting content shared between them
+once, which needs the content of every file in the builds. The files are
+downloaded to the cache unless they are cached already.
+
+Every bundle is checked against the limits of the bloat_policy file in the
+[paths] section of the configuration, or the file passed with --policy. A
+bundle growing past a fail limit fails the check, while growing past a warn
+limit or a limit it is exempt from is only reported. Without a policy file the
+high priority bundles os-core, os-core-update, c-basic and kernel fail when
+they grow by more than --max percent and every bundle warns when it grows by
+more than --warn percent.
+
+Pass --print to explain each bundle that grew past its limits with the files and
+source packages that grew the most, and --json to write the same to a file.
+Files are attributed to source packages using the repos of both builds, which
+must have been fetched with "diva fetch repo" first.
+
+Pass --range instead of versions to check the size change of every bundle
+from the first to the last build in the range, so that slow growth over many
+builds is flagged even if no single build crossed a limit. The builds are
+found through the previous version recorded in each MoM, --step only checks
+every Nth of them and --series writes the size of every bundle in each build
+to a CSV or JSON file.
+
+Pass --download to check the download size of a fresh install of every bundle
+instead, which is the compressed size of the zero packs of the bundle and its
+includes, or of the fullfiles of a bundle without a zero pack. The download
+size of updating every bundle from the first build to the second, through its
+delta pack or the changed fullfiles, is reported along with it. Only the
+manifests are downloaded, packs and fullfiles are measured with HEAD requests
+unless they are cached.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if bloatFlags.top < 1 {
+			return fmt.Errorf("--top must be at least 1, got %d", bloatFlags.top)
+		}
+		if bloatFlags.versionRange != "" {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.RangeArgs(1, 2)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		// Passing false to the last "recursive" flag because we don't want all manifest from minversion
 		u, err := diva.GetUpstreamInfo(conf, allFlags.upstreamURL, allFlags.version, true, false)
 		helpers.FailIfErr(err)
 
-		r := diva.NewSuite("bloat check", "check bundle bloat between build versions")
-
-		err = runBloatCheck(r, u, args)
+		policy, err := loadBloatPolicy()
 		helpers.FailIfErr(err)
 
-		if r.Failed > 0 {
-			os.Exit(1)
+		r := newSuite("bloat", "check bundle bloat between build versions")
+
+		switch {
+		case bloatFlags.versionRange != "" && bloatFlags.download:
+			err = fmt.Errorf("--download cannot be combined with --range")
+		case bloatFlags.versionRange != "":
+			err = runBloatRange(r, u, policy)
+		case bloatFlags.download:
+			err = runBloatDownload(r, u, policy, args)
+		default:
+			err = runBloatCheck(r, u, policy, args)
 		}
+		helpers.FailIfErr(err)
+
+		finishSuite(r)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(checkCmd)
 	checkCmd.AddCommand(bloatCheckCmd)
+	checkCmd.PersistentFlags().StringVar(&checkFlags.waivers, "waivers", "", "Waiver file, overrides the configured waivers")
+	checkCmd.PersistentFlags().BoolVar(&checkFlags.strict, "strict", false, "Fail on warnings")
+	checkCmd.PersistentFlags().StringVarP(&checkFlags.output, "output", "o", "tap", "Output format, tap, json, junit or markdown")
 
-	bloatCheckCmd.Flags().BoolVarP(&bloatFlags.printOutput, "print", "p", false, "Print out bundles that increased in size")
-	bloatCheckCmd.Flags().Float64Var(&bloatFlags.failCap, "max", 10.0, "Set the max % a high priority bundle may increase.")
-	bloatCheckCmd.Flags().Float64Var(&bloatFlags.warningCap, "warn", 20.0, "Set the % bundle size change that will emit a warning.")
+	bloatCheckCmd.Flags().BoolVarP(&bloatFlags.printOutput, "print", "p", false, "Print the files and packages that grew the flagged bundles")
+	bloatCheckCmd.Flags().IntVar(&bloatFlags.top, "top", 10, "Number of files and packages to print for each flagged bundle")
+	bloatCheckCmd.Flags().StringVar(&bloatFlags.jsonPath, "json", "", "Write the files and packages that grew the flagged bundles to a JSON file")
+	bloatCheckCmd.Flags().StringVarP(&bloatFlags.repoName, "reponame", "n", "clear", "Name of repo to attribute files to packages with")
+	bloatCheckCmd.Flags().StringVar(&bloatFlags.versionRange, "range", "", "Check the size change over the builds in <from>..<to>")
+	bloatCheckCmd.Flags().IntVar(&bloatFlags.step, "step", 1, "Only check every Nth build of --range")
+	bloatCheckCmd.Flags().StringVar(&bloatFlags.seriesPath, "series", "", "Write the bundle sizes of every build of --range to a file")
+	bloatCheckCmd.Flags().StringVar(&bloatFlags.seriesFormat, "series-format", "csv", "Format of the --series file, csv or json")
+	bloatCheckCmd.Flags().BoolVar(&bloatFlags.download, "download", false, "Check the download size of packs and fullfiles rather than the installed size")
+	bloatCheckCmd.Flags().StringVar(&bloatFlags.policyPath, "policy", "", "Bundle size policy file, overrides the configured policy")
+	bloatCheckCmd.Flags().Float64Var(&bloatFlags.failCap, "max", 10.0, "Set the max % a high priority bundle may increase, without a policy file.")
+	bloatCheckCmd.Flags().Float64Var(&bloatFlags.warningCap, "warn", 20.0, "Set the % bundle size change that will emit a warning, without a policy file.")
 }
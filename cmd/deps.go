@@ -0,0 +1,91 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/clearlinux/diva/diva"
+	"github.com/clearlinux/diva/internal/helpers"
+	"github.com/clearlinux/diva/pkginfo"
+	"github.com/spf13/cobra"
+)
+
+type depsCmdFlags struct {
+	repoName string
+	version  string
+}
+
+var depsFlags depsCmdFlags
+
+func init() {
+	checkCmd.AddCommand(depsCmd)
+	depsCmd.Flags().StringVarP(&depsFlags.repoName, "reponame", "n", "clear", "Name of repo")
+	depsCmd.Flags().StringVarP(&depsFlags.version, "version", "v", "0", "Version to check")
+}
+
+var depsCmd = &cobra.Command{
+	Use:   "deps",
+	Short: "Check that all runtime requirements in a repo can be resolved",
+	Long: `Check that every runtime requirement of every RPM in the repo specified by
+<reponame> and <version> is satisfied by another RPM in the same repo, taking
+version constraints into account. Requirements on file paths are resolved
+against the files shipped by each RPM. Rich dependencies such as
+"(foo if bar)" are not evaluated and are reported as skipped. The repo must
+have been fetched with "diva fetch repo" first.`,
+	Run: runCheckDeps,
+}
+
+func runCheckDeps(cmd *cobra.Command, args []string) {
+	repo := pkginfo.Repo{
+		Name:    depsFlags.repoName,
+		Version: depsFlags.version,
+		Type:    "B",
+	}
+
+	db, closeStore := openStore()
+	defer closeStore()
+
+	helpers.PrintBegin("Populating repo")
+	err := pkginfo.PopulateRepo(db, &repo, conf.Paths.CacheLocation)
+	helpers.FailIfErr(err)
+	helpers.PrintComplete("Repo populated successfully")
+
+	result := newSuite("deps", "validate runtime dependency closure")
+	checkDepsResolved(&repo, result)
+
+	finishSuite(result)
+}
+
+func checkDepsResolved(repo *pkginfo.Repo, result *diva.Results) {
+	if len(repo.Packages) == 0 {
+		result.Ok(false, fmt.Sprintf("repo %s version %s has packages", repo.Name, repo.Version))
+		return
+	}
+
+	unresolved, rich := pkginfo.UnresolvedRequires(repo)
+	if len(unresolved) == 0 {
+		result.Ok(true, "all runtime requirements resolved")
+	}
+	for _, u := range unresolved {
+		result.Ok(false, fmt.Sprintf("%s (from %s) requirement %s resolved",
+			u.RPM.Name, u.RPM.SRPMName, u.Requirement))
+	}
+
+	for _, u := range rich {
+		result.Skip(fmt.Sprintf("%s (from %s) requirement %s resolved",
+			u.RPM.Name, u.RPM.SRPMName, u.Requirement), "rich dependencies are not evaluated")
+	}
+}
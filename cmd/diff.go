@@ -0,0 +1,242 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/clearlinux/diva/diva"
+	"github.com/clearlinux/diva/internal/helpers"
+	"github.com/clearlinux/diva/pkginfo"
+	"github.com/clearlinux/diva/updatecontent"
+	"github.com/spf13/cobra"
+)
+
+type diffCmdFlags struct {
+	repoName string
+	source   bool
+	output   string
+}
+
+var diffFlags diffCmdFlags
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.AddCommand(diffRepoCmd)
+	diffCmd.AddCommand(diffUpdateCmd)
+	diffRepoCmd.Flags().StringVarP(&diffFlags.output, "output", "o", "text", "Output format, text or json")
+	diffRepoCmd.Flags().StringVarP(&diffFlags.repoName, "reponame", "n", "clear", "Name of repo")
+	diffRepoCmd.Flags().BoolVar(&diffFlags.source, "source", false, "Diff the source RPM repos")
+	diffUpdateCmd.Flags().StringVarP(&diffFlags.output, "output", "o", "text", "Output format, text, json or markdown")
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare content between releases",
+}
+
+var diffRepoCmd = &cobra.Command{
+	Use:   "repo <fromversion> <toversion>",
+	Short: "Compare the packages in two versions of a repo",
+	Long: `Compare the packages in the repo specified by <reponame> at <fromversion>
+and <toversion>. Reports packages added, removed, upgraded and downgraded using
+RPM version comparison, license changes, added and removed provides and added
+and removed files for every package in both versions. The binary repos are
+compared unless --source is passed. Both versions must have been fetched with
+"diva fetch repo" first.`,
+	Args: cobra.ExactArgs(2),
+	Run:  runDiffRepo,
+}
+
+var diffUpdateCmd = &cobra.Command{
+	Use:   "update <fromversion> <toversion>",
+	Short: "Compare the bundles in two update versions",
+	Long: `Compare the bundle manifests of the updates at <fromversion> and
+<toversion>. Reports bundles added and removed, and for every bundle in both
+versions the files added, deleted, modified and renamed along with the change
+in content size. The update metadata of both versions is fetched from the
+configured upstream URL if it is not cached yet.`,
+	Args: cobra.ExactArgs(2),
+	Run:  runDiffUpdate,
+}
+
+func runDiffRepo(cmd *cobra.Command, args []string) {
+	repoType := "B"
+	if diffFlags.source {
+		repoType = "S"
+	}
+
+	db, closeStore := openStore()
+	defer closeStore()
+
+	var repos []*pkginfo.Repo
+	for _, v := range args {
+		repo := &pkginfo.Repo{
+			Name:    diffFlags.repoName,
+			Version: v,
+			Type:    repoType,
+		}
+		err := pkginfo.PopulateRepo(db, repo, conf.Paths.CacheLocation)
+		helpers.FailIfErr(err)
+		if len(repo.Packages) == 0 {
+			helpers.FailIfErr(fmt.Errorf("repo %s version %s has no packages, fetch it with \"diva fetch repo\" first", repo.Name, v))
+		}
+		repos = append(repos, repo)
+	}
+
+	diff := pkginfo.DiffRepos(repos[0], repos[1])
+	var err error
+	switch diffFlags.output {
+	case "text":
+		printRepoDiff(os.Stdout, diff)
+	case "json":
+		err = printJSON(os.Stdout, diff)
+	default:
+		err = fmt.Errorf("unknown output format %s", diffFlags.output)
+	}
+	helpers.FailIfErr(err)
+}
+
+func runDiffUpdate(cmd *cobra.Command, args []string) {
+	var versions []uint
+	for _, v := range args {
+		u, err := diva.GetUpstreamInfo(conf, "", v, false, false)
+		helpers.FailIfErr(err)
+		err = diva.FetchUpdate(u)
+		helpers.FailIfErr(err)
+		versions = append(versions, u.MinVer)
+	}
+
+	diff, err := updatecontent.DiffUpdates(conf, versions[0], versions[1])
+	helpers.FailIfErr(err)
+
+	switch diffFlags.output {
+	case "text":
+		printUpdateDiff(os.Stdout, diff)
+	case "json":
+		err = printJSON(os.Stdout, diff)
+	case "markdown":
+		printUpdateDiffMarkdown(os.Stdout, diff)
+	default:
+		err = fmt.Errorf("unknown output format %s", diffFlags.output)
+	}
+	helpers.FailIfErr(err)
+}
+
+// printJSON prints v as indented JSON to w
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func printList(w io.Writer, title string, items []string) {
+	for _, item := range items {
+		fmt.Fprintf(w, "    %s %s\n", title, item)
+	}
+}
+
+func printPackageDiffs(w io.Writer, title string, diffs []pkginfo.PackageDiff) {
+	if len(diffs) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s (%d):\n", title, len(diffs))
+	for _, d := range diffs {
+		switch {
+		case d.FromEVR == pkginfo.EVR{} || d.FromEVR == d.ToEVR:
+			fmt.Fprintf(w, "  %s %s\n", d.Name, d.ToEVR)
+		case d.ToEVR == pkginfo.EVR{}:
+			fmt.Fprintf(w, "  %s %s\n", d.Name, d.FromEVR)
+		default:
+			fmt.Fprintf(w, "  %s %s -> %s\n", d.Name, d.FromEVR, d.ToEVR)
+		}
+		if d.FromLicense != d.ToLicense {
+			fmt.Fprintf(w, "    license %s -> %s\n", d.FromLicense, d.ToLicense)
+		}
+		printList(w, "+provides", d.AddedProvides)
+		printList(w, "-provides", d.RemovedProvides)
+		printList(w, "+file", d.AddedFiles)
+		printList(w, "-file", d.RemovedFiles)
+	}
+}
+
+func printRepoDiff(w io.Writer, diff pkginfo.RepoDiff) {
+	fmt.Fprintf(w, "Packages changed from %s to %s\n", diff.From, diff.To)
+	printPackageDiffs(w, "Added", diff.Added)
+	printPackageDiffs(w, "Removed", diff.Removed)
+	printPackageDiffs(w, "Upgraded", diff.Upgraded)
+	printPackageDiffs(w, "Downgraded", diff.Downgraded)
+	printPackageDiffs(w, "Changed", diff.Changed)
+}
+
+func printUpdateDiff(w io.Writer, diff updatecontent.UpdateDiff) {
+	fmt.Fprintf(w, "Bundles changed from %d to %d\n", diff.From, diff.To)
+	printList(w, "+bundle", diff.Added)
+	printList(w, "-bundle", diff.Removed)
+	for _, b := range diff.Changed {
+		fmt.Fprintf(w, "%s: %d -> %d bytes (%+d)\n", b.Name, b.FromSize, b.ToSize, b.SizeChange)
+		printList(w, "+file", b.Added)
+		printList(w, "-file", b.Deleted)
+		printList(w, "~file", b.Modified)
+		for _, r := range b.Renamed {
+			fmt.Fprintf(w, "    >file %s -> %s\n", r.From, r.To)
+		}
+	}
+}
+
+func printMarkdownList(w io.Writer, title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s:\n\n", title)
+	for _, item := range items {
+		fmt.Fprintf(w, "- `%s`\n", item)
+	}
+}
+
+func printUpdateDiffMarkdown(w io.Writer, diff updatecontent.UpdateDiff) {
+	fmt.Fprintf(w, "# Changes from %d to %d\n", diff.From, diff.To)
+	if len(diff.Added)+len(diff.Removed) > 0 {
+		fmt.Fprintf(w, "\n## Bundles\n")
+		printMarkdownList(w, "Added", diff.Added)
+		printMarkdownList(w, "Removed", diff.Removed)
+	}
+
+	if len(diff.Changed) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n## Changed bundles\n\n")
+	fmt.Fprintf(w, "| Bundle | Size | Change | Added | Deleted | Modified | Renamed |\n")
+	fmt.Fprintf(w, "|---|---:|---:|---:|---:|---:|---:|\n")
+	for _, b := range diff.Changed {
+		fmt.Fprintf(w, "| %s | %d | %+d | %d | %d | %d | %d |\n", b.Name, b.ToSize, b.SizeChange,
+			len(b.Added), len(b.Deleted), len(b.Modified), len(b.Renamed))
+	}
+
+	for _, b := range diff.Changed {
+		fmt.Fprintf(w, "\n### %s\n", b.Name)
+		printMarkdownList(w, "Added", b.Added)
+		printMarkdownList(w, "Deleted", b.Deleted)
+		printMarkdownList(w, "Modified", b.Modified)
+		var renamed []string
+		for _, r := range b.Renamed {
+			renamed = append(renamed, r.From+"` -> `"+r.To)
+		}
+		printMarkdownList(w, "Renamed", renamed)
+	}
+}
@@ -27,6 +27,7 @@ type allFetchFlags struct {
 	upstreamURL string
 	recursive   bool
 	update      bool
+	rpms        bool
 }
 
 var allFlags allFetchFlags
@@ -37,7 +38,7 @@ var fetchCmd = &cobra.Command{
 }
 
 var fetchAllCmd = &cobra.Command{
-	Use:   "all [--version <version>] [--bundleurl|--upstreamurl <url>] [--update]",
+	Use:   "all [--version <version>] [--bundleurl|--upstreamurl <url>] [--update] [--rpms]",
 	Run:   runFetchAllCmd,
 	Short: "Fetch metadata from <version> or latest available if <version> is not supplied",
 	Long: `Fetch latest bundle definitions, RPM repository, and update manifests from <version>.
@@ -45,7 +46,8 @@ If <version> is not supplied, fetch latest available content. Pass
 --upstreamurl to fetch RPMs and update metadata from a location other than the
 configured Upstream URL and --bundleurl to fetch the bundle definitions from a
 location other than default. If --update is passed, the cached Repo data will
-be updated with new information from the upstream url.
+be updated with new information from the upstream url. Only the RPM repository
+metadata is fetched unless --rpms is passed, which also downloads every RPM.
 
 RPMs will be cached under the cache location defined in your configuration or
 default to $HOME/clearlinux/data/rpms/<version>. Bundle definition files will
@@ -64,14 +66,17 @@ $HOME/clearlinux/projects/clr-bundles by default.`,
 }
 
 var fetchRepoCmd = &cobra.Command{
-	Use:   "repo [--version <version>] [--upstreamurl <url>]",
+	Use:   "repo [--version <version>] [--upstreamurl <url>] [--rpms]",
 	Run:   runFetchRepoCmd,
 	Short: "Fetch repo from <version> or latest if not supplied",
-	Long: `Fetch the RPM repository at <version> from the upstream URL if <version> is
-supplied, otherwise fetch the latest available. If --upstreamurl is supplied, fetch
-from <url> instead of the configured/default upstream URL. The repository is
-cached under the cache location defined in your configuration or default to
-$HOME/clearlinux/data/rpms/<version>.`,
+	Long: `Fetch the binary and source RPM repositories at <version> from the upstream
+URL if <version> is supplied, otherwise fetch the latest available. If
+--upstreamurl is supplied, fetch from <url> instead of the configured/default
+upstream URL. Only the repository metadata is fetched unless --rpms is passed,
+which also downloads every RPM for checks that need the package payloads and
+computes the swupd hash of every file, which requires rpm2cpio. The
+repositories are cached under the cache location defined in your configuration
+or default to $HOME/clearlinux/data/rpms/<version>.`,
 }
 
 var fetchUpdateCmd = &cobra.Command{
@@ -103,10 +108,12 @@ func init() {
 	fetchAllCmd.Flags().StringVarP(&allFlags.bundleURL, "bundleurl", "b", "", "URL from which to pull bundle definitions")
 	fetchAllCmd.Flags().StringVarP(&allFlags.upstreamURL, "upstreamurl", "u", "", "URL from which to pull update metadata")
 	fetchAllCmd.Flags().BoolVar(&allFlags.update, "update", false, "update pre-existing Repo")
+	fetchAllCmd.Flags().BoolVar(&allFlags.rpms, "rpms", false, "download RPM payloads in addition to repo metadata")
 
 	fetchBundlesCmd.Flags().StringVarP(&allFlags.bundleURL, "bundleurl", "b", "", "URL from which to pull bundle definitions")
 
 	fetchRepoCmd.Flags().StringVarP(&allFlags.version, "version", "v", "", "version from which to pull data")
+	fetchRepoCmd.Flags().BoolVar(&allFlags.rpms, "rpms", false, "download RPM payloads in addition to repo metadata")
 
 	fetchUpdateCmd.Flags().StringVarP(&allFlags.version, "version", "v", "", "version from which to pull data")
 	fetchUpdateCmd.Flags().StringVarP(&allFlags.upstreamURL, "upstreamurl", "u", "", "URL from which to pull update metadata")
@@ -116,8 +123,9 @@ func init() {
 func runFetchAllCmd(cmd *cobra.Command, args []string) {
 	u, err := diva.GetUpstreamInfo(conf, allFlags.upstreamURL, allFlags.version, allFlags.recursive, allFlags.update)
 	helpers.FailIfErr(err)
+	u.RPMs = allFlags.rpms
 
-	err = diva.FetchRepo(u)
+	err = diva.FetchRepo(conf, u)
 	helpers.FailIfErr(err)
 
 	err = diva.GetLatestBundles(conf, allFlags.bundleURL)
@@ -135,8 +143,9 @@ func runFetchBundlesCmd(cmd *cobra.Command, args []string) {
 func runFetchRepoCmd(cmd *cobra.Command, args []string) {
 	u, err := diva.GetUpstreamInfo(conf, allFlags.upstreamURL, allFlags.version, allFlags.recursive, allFlags.update)
 	helpers.FailIfErr(err)
+	u.RPMs = allFlags.rpms
 
-	err = diva.FetchRepo(u)
+	err = diva.FetchRepo(conf, u)
 	helpers.FailIfErr(err)
 }
 
@@ -0,0 +1,156 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/clearlinux/diva/bundle"
+	"github.com/clearlinux/diva/diva"
+	"github.com/clearlinux/diva/internal/helpers"
+	"github.com/clearlinux/diva/pkginfo"
+	"github.com/spf13/cobra"
+)
+
+type fileConflictsCmdFlags struct {
+	repoName string
+	version  string
+	bundle   string
+	bundles  bool
+}
+
+var fileConflictsFlags fileConflictsCmdFlags
+
+func init() {
+	checkCmd.AddCommand(fileConflictsCmd)
+	fileConflictsCmd.Flags().StringVarP(&fileConflictsFlags.repoName, "reponame", "n", "clear", "Name of repo")
+	fileConflictsCmd.Flags().StringVarP(&fileConflictsFlags.version, "version", "v", "0", "Version to check")
+	fileConflictsCmd.Flags().StringVarP(&fileConflictsFlags.bundle, "bundle", "b", "", "Only check packages installed by this bundle")
+	fileConflictsCmd.Flags().BoolVar(&fileConflictsFlags.bundles, "bundles", false, "Only check packages installed together by a bundle")
+}
+
+var fileConflictsCmd = &cobra.Command{
+	Use:   "file-conflicts",
+	Short: "Check for files shipped by multiple packages that differ",
+	Long: `Check for paths shipped by more than one package in the repo specified by
+<reponame> and <version> where the packages disagree on the file type,
+content, permissions, owner or group. Directories with mismatched permissions
+are conflicts too. Pass --bundle to only check the packages in the include
+closure of a single bundle, or --bundles to only report conflicts between
+packages that some bundle installs together. Each conflicting path is a test
+of its own, so a waiver can accept a single conflict. Content, permission and
+ownership conflicts are only found when the repo was fetched with
+"diva fetch repo --rpms", the repo metadata alone only records file types.`,
+	Run: runCheckFileConflicts,
+}
+
+func runCheckFileConflicts(cmd *cobra.Command, args []string) {
+	repo := pkginfo.Repo{
+		Name:    fileConflictsFlags.repoName,
+		Version: fileConflictsFlags.version,
+		Type:    "B",
+	}
+
+	db, closeStore := openStore()
+	defer closeStore()
+
+	helpers.PrintBegin("Populating repo")
+	err := pkginfo.PopulateRepo(db, &repo, conf.Paths.CacheLocation)
+	helpers.FailIfErr(err)
+	helpers.PrintComplete("Repo populated successfully")
+
+	var coinstalled func(a, b string) bool
+	if fileConflictsFlags.bundle != "" || fileConflictsFlags.bundles {
+		err = diva.GetLatestBundles(conf, "")
+		helpers.FailIfErr(err)
+
+		var bundles bundle.Set
+		bundles, err = bundle.GetAll(conf.Paths.BundleDefsRepo)
+		helpers.FailIfErr(err)
+
+		if fileConflictsFlags.bundle != "" {
+			b, ok := bundles[fileConflictsFlags.bundle]
+			if !ok {
+				helpers.FailIfErr(fmt.Errorf("%s is neither a pundle nor a bundle", fileConflictsFlags.bundle))
+			}
+			bundles = bundle.Set{fileConflictsFlags.bundle: b}
+		}
+		coinstalled = coinstalledByBundles(bundles)
+	}
+
+	result := newSuite("file-conflicts", "validate files shipped by multiple packages")
+	checkFileConflicts(&repo, coinstalled, result)
+
+	finishSuite(result)
+}
+
+// coinstalledByBundles returns a function reporting whether any of the
+// bundles installs both packages
+func coinstalledByBundles(bundles bundle.Set) func(a, b string) bool {
+	return func(a, b string) bool {
+		for _, bundle := range bundles {
+			if bundle.AllPackages[a] && bundle.AllPackages[b] {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func describeFile(f *pkginfo.File) string {
+	desc := []string{fmt.Sprintf("type %c", f.Type)}
+	for _, attr := range []string{f.Hash, f.SymlinkTarget, f.Permissions} {
+		if attr != "" {
+			desc = append(desc, attr)
+		}
+	}
+	if f.Owner != "" || f.Group != "" {
+		desc = append(desc, f.Owner+":"+f.Group)
+	}
+	return strings.Join(desc, " ")
+}
+
+// checkFileConflicts records a failing test for every conflicting path, so
+// each conflict can be waived on its own, or a single passing test if there
+// are none
+func checkFileConflicts(repo *pkginfo.Repo, coinstalled func(a, b string) bool, result *diva.Results) {
+	if len(repo.Packages) == 0 {
+		result.Ok(false, fmt.Sprintf("repo %s version %s has packages", repo.Name, repo.Version))
+		return
+	}
+
+	conflicts := pkginfo.FileConflicts(repo, coinstalled)
+	if len(conflicts) == 0 {
+		result.Ok(true, "no conflicting files shipped by multiple packages")
+		return
+	}
+
+	for _, c := range conflicts {
+		var pkgs []string
+		for name := range c.Files {
+			pkgs = append(pkgs, name)
+		}
+		sort.Strings(pkgs)
+
+		var lines []string
+		for _, name := range pkgs {
+			lines = append(lines, fmt.Sprintf("  %s: %s", name, describeFile(c.Files[name])))
+		}
+		result.Ok(false, fmt.Sprintf("no conflicting files at %s", c.Path),
+			fmt.Sprintf("%s differ:\n%s", strings.Join(c.Differences, ", "), strings.Join(lines, "\n")))
+	}
+}
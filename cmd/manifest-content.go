@@ -0,0 +1,100 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/clearlinux/diva/bundle"
+	"github.com/clearlinux/diva/diva"
+	"github.com/clearlinux/diva/internal/helpers"
+	"github.com/clearlinux/diva/pkginfo"
+	"github.com/clearlinux/diva/updatecontent"
+	"github.com/spf13/cobra"
+)
+
+type manifestContentCmdFlags struct {
+	repoName string
+	version  string
+	bundle   string
+}
+
+var manifestContentFlags manifestContentCmdFlags
+
+func init() {
+	checkCmd.AddCommand(manifestContentCmd)
+	manifestContentCmd.Flags().StringVarP(&manifestContentFlags.repoName, "reponame", "n", "clear", "Name of repo")
+	manifestContentCmd.Flags().StringVarP(&manifestContentFlags.version, "version", "v", "", "Version to check")
+	manifestContentCmd.Flags().StringVarP(&manifestContentFlags.bundle, "bundle", "b", "", "Bundle to check")
+}
+
+var manifestContentCmd = &cobra.Command{
+	Use:   "manifest-content",
+	Short: "Verify bundle manifests against the packages in the bundle definitions",
+	Long: `Verify that the update manifest of each bundle at <version>, or latest if
+--version was not provided, installs the files shipped by the packages listed
+in the bundle definition. Reports files shipped by the packages that the bundle
+does not install, files in the manifest that no package in the repo ships, and
+files whose type differs between the manifest and the package. Hashes are also
+compared for repos imported with swupd hashes. The repo specified by
+<reponame> and <version> must have been fetched with "diva fetch repo" first.
+Pass --bundle to only check a single bundle.`,
+	Run: runCheckManifestContent,
+}
+
+func runCheckManifestContent(cmd *cobra.Command, args []string) {
+	u, err := diva.GetUpstreamInfo(conf, "", manifestContentFlags.version, false, false)
+	helpers.FailIfErr(err)
+
+	version, err := strconv.ParseUint(u.Ver, 10, 32)
+	helpers.FailIfErr(err)
+
+	repo := pkginfo.Repo{
+		Name:    manifestContentFlags.repoName,
+		Version: u.Ver,
+		Type:    "B",
+	}
+
+	db, closeStore := openStore()
+	defer closeStore()
+
+	helpers.PrintBegin("Populating repo")
+	err = pkginfo.PopulateRepo(db, &repo, conf.Paths.CacheLocation)
+	helpers.FailIfErr(err)
+	helpers.PrintComplete("Repo populated successfully")
+
+	err = diva.GetLatestBundles(conf, "")
+	helpers.FailIfErr(err)
+
+	bundles, err := bundle.GetAll(conf.Paths.BundleDefsRepo)
+	helpers.FailIfErr(err)
+	if manifestContentFlags.bundle != "" {
+		b, ok := bundles[manifestContentFlags.bundle]
+		if !ok {
+			helpers.FailIfErr(fmt.Errorf("%s is neither a pundle nor a bundle", manifestContentFlags.bundle))
+		}
+		bundles = bundle.Set{manifestContentFlags.bundle: b}
+	}
+
+	err = diva.FetchUpdate(u)
+	helpers.FailIfErr(err)
+
+	result := newSuite("manifest-content", "validate bundle manifests against their packages")
+	err = updatecontent.CheckManifestContent(result, conf, &repo, bundles, uint(version))
+	helpers.FailIfErr(err)
+
+	finishSuite(result)
+}
@@ -51,7 +51,9 @@ var pyDepsCmd = &cobra.Command{
 OR the --buildroot option is passed, a build root will be constructed using a
 repo specified by <version> and <reponame>, which default to "0" and "clear",
 respectively. If no <path> is passed, but the --buildroot option is, the build
-root will be constructed here: "<conf.Mixer.MixWorkSpace>/update/image/<version>/full".`,
+root will be constructed here: "<conf.Mixer.MixWorkSpace>/update/image/<version>/full".
+Constructing the build root requires the RPMs to have been fetched with
+"diva fetch repo --rpms".`,
 	Run: runCheckPyDeps,
 }
 
@@ -70,9 +72,7 @@ func runCheckPyDeps(cmd *cobra.Command, args []string) {
 	}
 
 	results := CheckPyDeps(p)
-	if results.Failed > 0 {
-		os.Exit(1)
-	}
+	finishSuite(results)
 }
 
 // Check both rpm and pip are installed on the system, to be used by the Pipcheck
@@ -97,9 +97,17 @@ func createFullChroot(path string) error {
 		Type:    "B",
 	}
 
+	db, err := pkginfo.OpenStore(conf)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
 	// populate the repo information from the database
 	helpers.PrintBegin("Populating repo")
-	err = pkginfo.PopulateRepo(&repo, conf.Paths.CacheLocation)
+	err = pkginfo.PopulateRepo(db, &repo, conf.Paths.CacheLocation)
 	if err != nil {
 		return err
 	}
@@ -177,10 +185,10 @@ func createFullChroot(path string) error {
 
 // CheckPyDeps runs 'pip check' in a chroot at path
 func CheckPyDeps(path string) *diva.Results {
-	name := "Python dependencies"
+	name := "pydeps"
 	desc := "run pip check in full build root to check for missing python requirements"
-	r := diva.NewSuite(name, desc)
-	r.Header(1)
+	r := newSuite(name, desc)
+	r.Header(0)
 
 	err := helpers.RunCommandSilent("chroot", path, "pip", "check")
 	r.Ok(err == nil, desc)
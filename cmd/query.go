@@ -0,0 +1,116 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/clearlinux/diva/internal/helpers"
+	"github.com/clearlinux/diva/pkginfo"
+	"github.com/spf13/cobra"
+)
+
+type queryCmdFlags struct {
+	repoName string
+	version  string
+	source   bool
+}
+
+var queryFlags queryCmdFlags
+
+func init() {
+	rootCmd.AddCommand(queryCmd)
+	queryCmd.AddCommand(queryOwnerCmd)
+	queryCmd.AddCommand(queryWhatProvidesCmd)
+	queryCmd.AddCommand(queryWhatRequiresCmd)
+	queryCmd.PersistentFlags().StringVarP(&queryFlags.repoName, "reponame", "n", "clear", "Name of repo")
+	queryCmd.PersistentFlags().StringVarP(&queryFlags.version, "version", "v", "0", "Version to query")
+	queryCmd.PersistentFlags().BoolVar(&queryFlags.source, "source", false, "Query the source RPM repo")
+}
+
+var queryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "Query package relationships in an imported repo",
+	Long: `Query which packages own files, provide capabilities or require packages in
+the repo specified by <reponame> and <version>. The binary repo is queried
+unless --source is passed. The repo must have been fetched with "diva fetch
+repo" first.`,
+}
+
+var queryOwnerCmd = &cobra.Command{
+	Use:   "owner <path>",
+	Short: "Print the packages that ship a file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runQuery(func(db pkginfo.Store, repo *pkginfo.Repo) ([]string, error) {
+			return pkginfo.WhatOwns(db, repo, args[0])
+		})
+	},
+}
+
+var queryWhatProvidesCmd = &cobra.Command{
+	Use:   "whatprovides <capability>",
+	Short: "Print the packages that provide a capability",
+	Long: `Print the packages that provide <capability>, ignoring versions. A
+<capability> that is an absolute path is also provided by the packages that
+ship a file at that path.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runQuery(func(db pkginfo.Store, repo *pkginfo.Repo) ([]string, error) {
+			return pkginfo.WhatProvides(db, repo, args[0])
+		})
+	},
+}
+
+var queryWhatRequiresCmd = &cobra.Command{
+	Use:   "whatrequires <package>",
+	Short: "Print the packages that require a package",
+	Long: `Print the packages with a requirement satisfied by <package>, either
+through its versioned provides or the files it ships. These are the packages
+that may break if <package> is dropped, other packages that could satisfy the
+same requirements are not taken into account.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runQuery(func(db pkginfo.Store, repo *pkginfo.Repo) ([]string, error) {
+			return pkginfo.WhatRequires(db, repo, args[0])
+		})
+	},
+}
+
+func runQuery(query func(pkginfo.Store, *pkginfo.Repo) ([]string, error)) {
+	repo := &pkginfo.Repo{
+		Name:    queryFlags.repoName,
+		Version: queryFlags.version,
+		Type:    "B",
+	}
+	if queryFlags.source {
+		repo.Type = "S"
+	}
+
+	db, closeStore := openStore()
+	defer closeStore()
+
+	names, err := query(db, repo)
+	helpers.FailIfErr(err)
+
+	for _, name := range names {
+		fmt.Println(name)
+	}
+
+	// like rpm -q, finding nothing is a failure
+	if len(names) == 0 {
+		helpers.Exit(1)
+	}
+}
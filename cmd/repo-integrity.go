@@ -0,0 +1,89 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/clearlinux/diva/diva"
+	"github.com/clearlinux/diva/internal/helpers"
+	"github.com/clearlinux/diva/pkginfo"
+	"github.com/spf13/cobra"
+)
+
+type repoIntegrityCmdFlags struct {
+	repoName string
+	version  string
+	source   bool
+}
+
+var repoIntegrityFlags repoIntegrityCmdFlags
+
+func init() {
+	checkCmd.AddCommand(repoIntegrityCmd)
+	repoIntegrityCmd.Flags().StringVarP(&repoIntegrityFlags.repoName, "reponame", "n", "clear", "Name of repo")
+	repoIntegrityCmd.Flags().StringVarP(&repoIntegrityFlags.version, "version", "v", "0", "Version to check")
+	repoIntegrityCmd.Flags().BoolVar(&repoIntegrityFlags.source, "source", false, "Check the source RPM repo")
+}
+
+var repoIntegrityCmd = &cobra.Command{
+	Use:   "repo-integrity",
+	Short: "Verify cached RPMs against the repo metadata checksums",
+	Long: `Verify the RPMs cached for the repo specified by <reponame> and <version>
+against the checksums listed in the repo metadata. Reports RPMs that are
+corrupt, RPMs listed in the metadata that are missing from the cache and extra
+RPMs in the cache that the metadata does not list. The binary repo is checked
+unless --source is passed. The RPMs must have been fetched with
+"diva fetch repo --rpms" first.`,
+	Run: runCheckRepoIntegrity,
+}
+
+func runCheckRepoIntegrity(cmd *cobra.Command, args []string) {
+	repo := &pkginfo.Repo{
+		Name:    repoIntegrityFlags.repoName,
+		Version: repoIntegrityFlags.version,
+		Type:    "B",
+	}
+	if repoIntegrityFlags.source {
+		repo.Type = "S"
+	}
+
+	helpers.PrintBegin("Verifying cached RPMs")
+	res, err := pkginfo.VerifyRepoCache(repo, conf.Paths.CacheLocation)
+	helpers.FailIfErr(err)
+	helpers.PrintComplete("%d RPMs verified", len(res.Verified))
+
+	result := newSuite("repo-integrity", "validate cached RPMs against repo metadata")
+	checkRepoIntegrity(res, result)
+
+	finishSuite(result)
+}
+
+func checkRepoIntegrity(res *pkginfo.RepoIntegrity, result *diva.Results) {
+	result.Ok(len(res.Corrupt) == 0, "cached RPMs match repo metadata checksums")
+	if len(res.Corrupt) > 0 {
+		result.Diagnostic("corrupt RPMs:\n" + strings.Join(res.Corrupt, "\n"))
+	}
+
+	result.Ok(len(res.Missing) == 0, "all RPMs in repo metadata are cached")
+	if len(res.Missing) > 0 {
+		result.Diagnostic("missing RPMs:\n" + strings.Join(res.Missing, "\n"))
+	}
+
+	result.Ok(len(res.Extra) == 0, "no RPMs cached that are not in repo metadata")
+	if len(res.Extra) > 0 {
+		result.Diagnostic("extra RPMs:\n" + strings.Join(res.Extra, "\n"))
+	}
+}
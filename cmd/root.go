@@ -17,9 +17,11 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/clearlinux/diva/internal/config"
 	"github.com/clearlinux/diva/internal/helpers"
+	"github.com/clearlinux/diva/pkginfo"
 
 	"github.com/spf13/cobra"
 )
@@ -63,11 +65,29 @@ func initConfig() {
 	helpers.FailIfErr(err)
 }
 
+// openStore opens the package store configured in conf. The returned function
+// closes it, and it is also closed when diva exits early through helpers.Exit
+// or helpers.FailIfErr, such as when a check fails, so a private redis-server
+// is always released.
+func openStore() (pkginfo.Store, func()) {
+	db, err := pkginfo.OpenStore(conf)
+	helpers.FailIfErr(err)
+
+	var once sync.Once
+	closeStore := func() {
+		once.Do(func() {
+			_ = db.Close()
+		})
+	}
+	helpers.OnExit(closeStore)
+	return db, closeStore
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		helpers.Exit(1)
 	}
 }
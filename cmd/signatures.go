@@ -0,0 +1,94 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/clearlinux/diva/diva"
+	"github.com/clearlinux/diva/internal/helpers"
+	"github.com/clearlinux/diva/pkginfo"
+	"github.com/spf13/cobra"
+)
+
+type signaturesCmdFlags struct {
+	repoName string
+	version  string
+	source   bool
+	keyring  string
+}
+
+var signaturesFlags signaturesCmdFlags
+
+func init() {
+	checkCmd.AddCommand(signaturesCmd)
+	signaturesCmd.Flags().StringVarP(&signaturesFlags.repoName, "reponame", "n", "clear", "Name of repo")
+	signaturesCmd.Flags().StringVarP(&signaturesFlags.version, "version", "v", "0", "Version to check")
+	signaturesCmd.Flags().BoolVar(&signaturesFlags.source, "source", false, "Check the source RPM repo")
+	signaturesCmd.Flags().StringVarP(&signaturesFlags.keyring, "keyring", "k", "", "OpenPGP public keyring, overrides the configured keyring")
+}
+
+var signaturesCmd = &cobra.Command{
+	Use:   "signatures",
+	Short: "Verify RPM signatures against the configured keyring",
+	Long: `Verify the signature of every RPM cached for the repo specified by
+<reponame> and <version> against the OpenPGP public keyring set by keyring in
+the [paths] section of the configuration, or by --keyring. Unsigned RPMs, RPMs
+signed by a key not in the keyring and RPMs with bad signatures all fail. The
+binary repo is checked unless --source is passed. The RPMs must have been
+fetched with "diva fetch repo --rpms" first.`,
+	Run: runCheckSignatures,
+}
+
+func runCheckSignatures(cmd *cobra.Command, args []string) {
+	repo := &pkginfo.Repo{
+		Name:    signaturesFlags.repoName,
+		Version: signaturesFlags.version,
+		Type:    "B",
+	}
+	if signaturesFlags.source {
+		repo.Type = "S"
+	}
+
+	keyring := signaturesFlags.keyring
+	if keyring == "" {
+		keyring = conf.Paths.Keyring
+	}
+
+	helpers.PrintBegin("Checking RPM signatures")
+	checks, err := pkginfo.CheckRepoSignatures(repo, conf.Paths.CacheLocation, keyring)
+	helpers.FailIfErr(err)
+	helpers.PrintComplete("%d RPMs checked", len(checks))
+
+	result := newSuite("signatures", "validate RPM signatures")
+	checkSignatures(checks, result)
+
+	finishSuite(result)
+}
+
+func checkSignatures(checks []pkginfo.SignatureCheck, result *diva.Results) {
+	for _, c := range checks {
+		desc := fmt.Sprintf("%s signature is valid", c.RPM)
+		result.Ok(c.Status == pkginfo.SignatureValid, desc)
+		switch {
+		case c.Status == pkginfo.SignatureValid:
+			continue
+		case c.Err != nil:
+			result.Diagnostic(fmt.Sprintf("%s: %s", c.Status, c.Err))
+		default:
+			result.Diagnostic(c.Status)
+		}
+	}
+}
@@ -16,7 +16,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/clearlinux/diva/diva"
 	"github.com/clearlinux/diva/internal/helpers"
@@ -43,9 +42,10 @@ var ucCmd = &cobra.Command{
 	Short: "Validate update file and pack content",
 	Long: `Validate update content for <version> or latest if --version was not provided.
 Validates that all file and pack content is available and correct and their
-hashes match those provided in their respective manifests. If --recursive was
-passed, perform the check on all update content reachable through the
-manifests, otherwise validate only the current version.`,
+hashes match those provided in their respective manifests, and that files
+shipped by more than one bundle have the same hash and type in each of them.
+If --recursive was passed, perform the check on all update content reachable
+through the manifests, otherwise validate only the current version.`,
 	Run: runUCCheck,
 }
 
@@ -60,15 +60,13 @@ func runUCCheck(cmd *cobra.Command, args []string) {
 	results, err := UCCheck(v, ucFlags.recursive)
 	helpers.FailIfErr(err)
 
-	if results.Failed > 0 {
-		os.Exit(1)
-	}
+	finishSuite(results)
 }
 
 // UCCheck runs update content checks against manifests and their related file
 // and pack contents
 func UCCheck(version uint, recursive bool) (*diva.Results, error) {
-	r := diva.NewSuite("updatecontent", "check update content for release")
+	r := newSuite("updatecontent", "check update content for release")
 	u := diva.UInfo{
 		Ver:      fmt.Sprint(version),
 		URL:      conf.UpstreamURL,
@@ -92,6 +90,10 @@ func UCCheck(version uint, recursive bool) (*diva.Results, error) {
 	if err != nil {
 		return r, err
 	}
+	err = updatecontent.CheckBundleFileConflicts(r, conf, version)
+	if err != nil {
+		return r, err
+	}
 	err = updatecontent.CheckFileHashes(r, conf, version, u.MinVer)
 	if err != nil {
 		return r, err
@@ -0,0 +1,103 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/clearlinux/diva/diva"
+	"github.com/clearlinux/diva/internal/helpers"
+	"github.com/clearlinux/diva/pkginfo"
+	"github.com/spf13/cobra"
+)
+
+type versionRegressionCmdFlags struct {
+	repoName string
+}
+
+var versionRegressionFlags versionRegressionCmdFlags
+
+func init() {
+	checkCmd.AddCommand(versionRegressionCmd)
+	versionRegressionCmd.Flags().StringVarP(&versionRegressionFlags.repoName, "reponame", "n", "clear", "Name of repo")
+}
+
+var versionRegressionCmd = &cobra.Command{
+	Use:   "version-regression <fromversion> <toversion>",
+	Short: "Check that no package version goes backwards between releases",
+	Long: `Check that every package in the repo specified by <reponame> at <fromversion>
+that is still shipped at <toversion> has the same or a newer version, using RPM
+version comparison, and that every source RPM dropped at <toversion> had its
+binary packages obsoleted by another package. Either would leave dnf users of
+the repo unable to upgrade cleanly. Both versions must have been fetched with
+"diva fetch repo" first.`,
+	Args: cobra.ExactArgs(2),
+	Run:  runCheckVersionRegression,
+}
+
+func runCheckVersionRegression(cmd *cobra.Command, args []string) {
+	db, closeStore := openStore()
+	defer closeStore()
+
+	helpers.PrintBegin("Populating repos")
+	var repos []*pkginfo.Repo
+	for _, v := range args {
+		repo := &pkginfo.Repo{
+			Name:    versionRegressionFlags.repoName,
+			Version: v,
+			Type:    "B",
+		}
+		err := pkginfo.PopulateRepo(db, repo, conf.Paths.CacheLocation)
+		helpers.FailIfErr(err)
+		repos = append(repos, repo)
+	}
+	helpers.PrintComplete("Repos populated successfully")
+
+	result := newSuite("version-regression", "validate package versions do not regress")
+	checkVersionRegression(repos[0], repos[1], result)
+
+	finishSuite(result)
+}
+
+func checkVersionRegression(from, to *pkginfo.Repo, result *diva.Results) {
+	var empty bool
+	for _, repo := range []*pkginfo.Repo{from, to} {
+		if len(repo.Packages) == 0 {
+			result.Ok(false, fmt.Sprintf("repo %s version %s has packages", repo.Name, repo.Version))
+			empty = true
+		}
+	}
+	if empty {
+		return
+	}
+
+	diff := pkginfo.DiffRepos(from, to)
+	for _, d := range diff.Downgraded {
+		result.Ok(false, fmt.Sprintf("%s version %s is not older than %s", d.Name, d.ToEVR, d.FromEVR))
+	}
+	if len(diff.Downgraded) == 0 {
+		result.Ok(true, "no package versions regressed")
+	}
+
+	dropped := pkginfo.DroppedSRPMs(from, to)
+	for _, s := range dropped {
+		result.Ok(false, fmt.Sprintf("packages from dropped %s source RPM are obsoleted", s.Name))
+		result.Diagnostic("packages not obsoleted:\n" + strings.Join(s.Packages, "\n"))
+	}
+	if len(dropped) == 0 {
+		result.Ok(true, "packages from dropped source RPMs are obsoleted")
+	}
+}
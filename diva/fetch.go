@@ -29,13 +29,15 @@ import (
 )
 
 // UInfo describes basic information about the upstream update server and local
-// cache location
+// cache location. RPMs is set when full RPM payloads should be downloaded
+// rather than only the repo metadata.
 type UInfo struct {
 	Ver      string
 	MinVer   uint
 	URL      string
 	CacheLoc string
 	Update   bool
+	RPMs     bool
 }
 
 // GetUpstreamInfo populates the UInfo struct and returns it
@@ -73,28 +75,59 @@ func GetUpstreamInfo(conf *config.Config, upstreamURL string, version string, re
 	return u, err
 }
 
-// FetchRepo fetches the RPM repo at the u.URL baseurl to the local cache
-// location
-func FetchRepo(u UInfo) error {
+func fetchRepo(db pkginfo.Store, repo *pkginfo.Repo, u UInfo) error {
+	helpers.PrintBegin("fetching repo from %s", repo.URI)
+	var path string
+	var err error
+	if u.RPMs {
+		path, err = pkginfo.DownloadRepoFiles(repo, u.Update)
+		if err != nil {
+			return err
+		}
+		err = pkginfo.ImportAllRPMs(db, repo, u.Update, path)
+	} else {
+		path, err = pkginfo.DownloadRepoMetadata(repo, u.Update)
+		if err != nil {
+			return err
+		}
+		err = pkginfo.ImportRepoMetadata(db, repo, path)
+	}
+	if err != nil {
+		return err
+	}
+	helpers.PrintComplete("repo cached at %s", path)
+	return nil
+}
+
+// FetchRepo fetches the binary and source RPM repos at the u.URL baseurl to
+// the local cache location and imports them into the configured pkginfo
+// storage backend. Only the repo metadata is fetched unless u.RPMs is set.
+func FetchRepo(conf *config.Config, u UInfo) error {
+	db, err := pkginfo.OpenStore(conf)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
 	repo := &pkginfo.Repo{
 		URI:     fmt.Sprintf("%s/releases/%s/clear/x86_64/os/", u.URL, u.Ver),
 		Name:    "clear",
 		Version: u.Ver,
 		Type:    "B",
 	}
-
-	helpers.PrintBegin("fetching repo from %s", repo.URI)
-	path, err := pkginfo.DownloadRepoFiles(repo, u.Update)
-	if err != nil {
+	if err = fetchRepo(db, repo, u); err != nil {
 		return err
 	}
 
-	err = pkginfo.ImportAllRPMs(repo, u.Update, path)
-	if err != nil {
-		return err
+	srcRepo := &pkginfo.Repo{
+		URI:     fmt.Sprintf("%s/releases/%s/clear/source/SRPMS/", u.URL, u.Ver),
+		Name:    "clear",
+		Version: u.Ver,
+		Type:    "S",
 	}
-	helpers.PrintComplete("repo cached at %s", path)
-	return nil
+	return fetchRepo(db, srcRepo, u)
 }
 
 // GetBundleAtTag clones the repo if it doesn't exist, and then checks
@@ -232,10 +265,12 @@ func FetchUpdateFiles(u UInfo) error {
 	}
 
 	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed int
+	var firstErr error
 	nworkers := 8
 	wg.Add(nworkers)
 	fChan := make(chan finfo)
-	errChan := make(chan error, nworkers)
 
 	for i := 0; i < nworkers; i++ {
 		go func() {
@@ -250,7 +285,12 @@ func FetchUpdateFiles(u UInfo) error {
 				_ = os.Remove(f.out)
 
 				if f.err != nil {
-					errChan <- f.err
+					mu.Lock()
+					failed++
+					if firstErr == nil {
+						firstErr = f.err
+					}
+					mu.Unlock()
 				}
 			}
 		}()
@@ -262,10 +302,10 @@ func FetchUpdateFiles(u UInfo) error {
 	close(fChan)
 	wg.Wait()
 
-	if len(errChan) > 0 {
-		helpers.PrintComplete("errors downloading %d files", len(errChan))
-	} else {
-		helpers.PrintComplete("files cached at %s", filepath.Join(u.CacheLoc, "update"))
+	if failed > 0 {
+		helpers.PrintComplete("errors downloading %d files", failed)
+		return fmt.Errorf("failed to download %d of %d files: %v", failed, len(dlFiles), firstErr)
 	}
+	helpers.PrintComplete("files cached at %s", filepath.Join(u.CacheLoc, "update"))
 	return nil
 }
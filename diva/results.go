@@ -16,18 +16,61 @@ package diva
 
 import (
 	"encoding/json"
+	"encoding/xml"
+	"fmt"
 	"io"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/mndrix/tap-go" // tap
 )
 
-// Results holds the results of a test run
+// Test case statuses
+const (
+	StatusPass   = "pass"
+	StatusFail   = "fail"
+	StatusWarn   = "warn"
+	StatusSkip   = "skip"
+	StatusTodo   = "todo"
+	StatusWaived = "waived"
+)
+
+// TestCase is the result of a single test of a suite. Duration is the time
+// since the previous test of the suite finished, or since the suite started.
+// Reason is why a test was skipped or waived.
+type TestCase struct {
+	Suite       string        `json:"suite"`
+	Name        string        `json:"name"`
+	Status      string        `json:"status"`
+	Reason      string        `json:"reason,omitempty"`
+	Diagnostics []string      `json:"diagnostics,omitempty"`
+	Duration    time.Duration `json:"duration"`
+}
+
+// Results holds the results of a test run. The TAP output is written as the
+// tests run, Cases keeps every test so the results can also be printed in
+// other formats once the run is complete. Diagnostics holds the diagnostics
+// emitted before the first test. When Strict is set warnings are failures.
+// Failures accepted by one of the Waivers are counted as waived instead.
+// Tests may be recorded from several goroutines at once, passing their
+// diagnostics along with them keeps each test and its diagnostics together.
 type Results struct {
-	Name        string
-	Description string
-	Passed      uint
-	Failed      uint
-	*tap.T
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Strict      bool        `json:"strict"`
+	Passed      uint        `json:"passed"`
+	Failed      uint        `json:"failed"`
+	Warnings    uint        `json:"warnings"`
+	Skipped     uint        `json:"skipped"`
+	Todos       uint        `json:"todo"`
+	Waived      uint        `json:"waived"`
+	Waivers     []Waiver    `json:"-"`
+	Diagnostics []string    `json:"diagnostics,omitempty"`
+	Cases       []*TestCase `json:"tests"`
+	*tap.T      `json:"-"`
+	last        time.Time
+	mu          sync.Mutex
 }
 
 // NewSuite returns a new *Results object
@@ -36,26 +79,325 @@ func NewSuite(name, desc string) *Results {
 		Name:        name,
 		Description: desc,
 		T:           tap.New(),
+		last:        time.Now(),
+	}
+}
+
+// record adds a test case with status to the results and counts it. r.mu
+// must be held.
+func (r *Results) record(status, description, reason string) {
+	switch status {
+	case StatusPass:
+		r.Passed++
+	case StatusFail:
+		r.Failed++
+	case StatusWarn:
+		r.Warnings++
+	case StatusSkip:
+		r.Skipped++
+	case StatusTodo:
+		r.Todos++
+	case StatusWaived:
+		r.Waived++
+	}
+
+	now := time.Now()
+	r.Cases = append(r.Cases, &TestCase{
+		Suite:    r.Name,
+		Name:     description,
+		Status:   status,
+		Reason:   reason,
+		Duration: now.Sub(r.last),
+	})
+	r.last = now
+}
+
+// diagnose records the messages for the last test and writes them as TAP.
+// r.mu must be held.
+func (r *Results) diagnose(messages []string) {
+	for _, message := range messages {
+		if len(r.Cases) == 0 {
+			r.Diagnostics = append(r.Diagnostics, message)
+		} else {
+			c := r.Cases[len(r.Cases)-1]
+			c.Diagnostics = append(c.Diagnostics, message)
+		}
+		r.T.Diagnostic(message)
+	}
+}
+
+// waiverFor returns the first waiver for the test of r with description
+func (r *Results) waiverFor(description string) *Waiver {
+	for i := range r.Waivers {
+		if r.Waivers[i].matches(r.Name, description) {
+			return &r.Waivers[i]
+		}
+	}
+	return nil
+}
+
+// fail records a failed test, unless a waiver accepts the failure. A waived
+// failure is not ok in TAP, with a TODO directive so it does not fail the
+// run. r.mu must be held.
+func (r *Results) fail(description string, diagnostics []string) {
+	w := r.waiverFor(description)
+	if w == nil || w.expired(time.Now()) {
+		r.record(StatusFail, description, "")
+		r.T.Ok(false, description)
+		r.diagnose(diagnostics)
+		if w != nil {
+			r.diagnose([]string{fmt.Sprintf("waiver expired on %s: %s", w.Expires.Format("2006-01-02"), w)})
+		}
+		return
+	}
+
+	reason := "waived: " + w.String()
+	r.record(StatusWaived, description, reason)
+	r.T.Ok(false, description+" # TODO "+reason)
+	r.diagnose(diagnostics)
+}
+
+// Ok records a test pass or fail based on the test argument, along with its
+// diagnostics
+func (r *Results) Ok(test bool, description string, diagnostics ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !test {
+		r.fail(description, diagnostics)
+		return
+	}
+	r.record(StatusPass, description, "")
+	r.T.Ok(test, description)
+	r.diagnose(diagnostics)
+}
+
+// Warn records a test that found a problem which does not fail the run, along
+// with its diagnostics. When r.Strict is set the test fails instead. TAP has
+// no warnings, so a warning is ok in TAP followed by a "warning:" diagnostic
+// line, and is only told apart from a pass in the json, junit and markdown
+// output.
+func (r *Results) Warn(description string, diagnostics ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.Strict {
+		r.fail(description, diagnostics)
+		return
+	}
+	r.record(StatusWarn, description, "")
+	r.T.Ok(true, description)
+	r.T.Diagnostic("warning: " + description)
+	r.diagnose(diagnostics)
+}
+
+// Skip records a test that was not run, for reason
+func (r *Results) Skip(description, reason string, diagnostics ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.record(StatusSkip, description, reason)
+	r.T.Ok(true, description+" # SKIP "+reason)
+	r.diagnose(diagnostics)
+}
+
+// Todo records a test of something that is known not to work yet, so that it
+// does not fail the run. A passing todo test is counted as passed.
+func (r *Results) Todo(test bool, description string, diagnostics ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := StatusPass
+	if !test {
+		status = StatusTodo
+	}
+	r.record(status, description, "")
+	r.T.Todo().Ok(test, description)
+	r.diagnose(diagnostics)
+}
+
+// CheckWaivers records a failed test for every expired waiver of the suite,
+// so that waivers are removed or renewed rather than forgotten
+func (r *Results) CheckWaivers() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for i := range r.Waivers {
+		w := &r.Waivers[i]
+		if w.Suite != r.Name || !w.expired(now) {
+			continue
+		}
+		desc := fmt.Sprintf("waiver for %s has not expired", w.target())
+		r.record(StatusFail, desc, "")
+		r.T.Ok(false, desc)
+		r.diagnose([]string{fmt.Sprintf("expired on %s: %s", w.Expires.Format("2006-01-02"), w)})
 	}
 }
 
+// Diagnostic records a diagnostic message for the last test. Tests recorded
+// concurrently should pass their diagnostics to Ok instead, as another test
+// may be recorded in between.
+func (r *Results) Diagnostic(message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.diagnose([]string{message})
+}
+
+// duration returns the total duration of the tests in r
+func (r *Results) duration() time.Duration {
+	var d time.Duration
+	for _, c := range r.Cases {
+		d += c.Duration
+	}
+	return d
+}
+
 // PrintJSON prints the Results in JSON format to the Writer provided.
 func (r *Results) PrintJSON(w io.Writer) error {
-	resOut, err := json.Marshal(r)
+	resOut, err := json.MarshalIndent(r, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	_, err = io.WriteString(w, string(resOut))
+	_, err = io.WriteString(w, string(resOut)+"\n")
 	return err
 }
 
-// Ok records a test pass or fail based on the test argument
-func (r *Results) Ok(test bool, description string) {
-	if test {
-		r.Passed++
-	} else {
-		r.Failed++
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  uint            `xml:"failures,attr"`
+	Skipped   uint            `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	SystemOut string          `xml:"system-out,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// PrintJUnit prints the Results as a JUnit XML test suite to the Writer
+// provided. The diagnostics of a failed test are the text of its failure,
+// those of any other test its output. JUnit has no warnings, so warnings pass
+// with their output starting with "warning", and todo and waived tests are
+// skipped.
+func (r *Results) PrintJUnit(w io.Writer) error {
+	suite := junitTestSuite{
+		Name:      r.Name,
+		Tests:     len(r.Cases),
+		Failures:  r.Failed,
+		Skipped:   r.Skipped + r.Todos + r.Waived,
+		Time:      junitTime(r.duration()),
+		SystemOut: strings.Join(r.Diagnostics, "\n"),
 	}
-	r.T.Ok(test, description)
+	for _, c := range r.Cases {
+		tc := junitTestCase{
+			Name:      c.Name,
+			ClassName: c.Suite,
+			Time:      junitTime(c.Duration),
+		}
+		diag := strings.Join(c.Diagnostics, "\n")
+		switch c.Status {
+		case StatusFail:
+			tc.Failure = &junitFailure{Message: c.Name, Text: diag}
+		case StatusWarn:
+			tc.SystemOut = strings.TrimSpace("warning\n" + diag)
+		case StatusSkip:
+			tc.Skipped = &junitSkipped{Message: c.Reason}
+			tc.SystemOut = diag
+		case StatusTodo:
+			tc.Skipped = &junitSkipped{Message: "todo"}
+			tc.SystemOut = diag
+		case StatusWaived:
+			tc.Skipped = &junitSkipped{Message: c.Reason}
+			tc.SystemOut = diag
+		default:
+			tc.SystemOut = diag
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	out, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, xml.Header+string(out)+"\n")
+	return err
+}
+
+// markdownCell escapes s for use in a markdown table cell
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
+
+// PrintMarkdown prints the Results as a markdown summary to the Writer
+// provided, with a table of every test followed by the diagnostics of the
+// failed, warned and waived tests
+func (r *Results) PrintMarkdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s\n\n%s\n\n", r.Name, r.Description)
+	fmt.Fprintf(&b, "%d passed, %d failed, %d warnings, %d skipped, %d todo, %d waived\n",
+		r.Passed, r.Failed, r.Warnings, r.Skipped, r.Todos, r.Waived)
+
+	if len(r.Cases) > 0 {
+		fmt.Fprintf(&b, "\n| Status | Test |\n|---|---|\n")
+		for _, c := range r.Cases {
+			name := c.Name
+			if c.Reason != "" {
+				name += " (" + c.Reason + ")"
+			}
+			fmt.Fprintf(&b, "| %s | %s |\n", c.Status, markdownCell(name))
+		}
+	}
+
+	for _, c := range r.Cases {
+		if (c.Status != StatusFail && c.Status != StatusWarn && c.Status != StatusWaived) || len(c.Diagnostics) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n### %s\n\n```\n%s\n```\n", c.Name, strings.Join(c.Diagnostics, "\n"))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Print prints the Results to the Writer provided in format, which is one of
+// json, junit or markdown. TAP is not printed, it is written as the tests run.
+func (r *Results) Print(w io.Writer, format string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch format {
+	case "tap":
+		return nil
+	case "json":
+		return r.PrintJSON(w)
+	case "junit":
+		return r.PrintJUnit(w)
+	case "markdown":
+		return r.PrintMarkdown(w)
+	}
+	return fmt.Errorf("unknown output format %s", format)
 }
@@ -0,0 +1,225 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diva
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func testSuite() *Results {
+	r := NewSuite("suite", "a test suite")
+	r.Writer = ioutil.Discard
+	r.Diagnostic("before any test")
+	r.Ok(true, "first")
+	r.Ok(false, "second")
+	r.Diagnostic("why it failed")
+	r.Diagnostic("more | details")
+	return r
+}
+
+func TestResultsCases(t *testing.T) {
+	r := testSuite()
+	if r.Passed != 1 || r.Failed != 1 {
+		t.Errorf("expected 1 passed and 1 failed but got %d and %d", r.Passed, r.Failed)
+	}
+	if !reflect.DeepEqual(r.Diagnostics, []string{"before any test"}) {
+		t.Errorf("unexpected suite diagnostics %v", r.Diagnostics)
+	}
+	if len(r.Cases) != 2 {
+		t.Fatalf("expected 2 cases but got %d", len(r.Cases))
+	}
+
+	c := r.Cases[1]
+	if c.Suite != "suite" || c.Name != "second" || c.Status != StatusFail {
+		t.Errorf("unexpected case %+v", c)
+	}
+	if !reflect.DeepEqual(c.Diagnostics, []string{"why it failed", "more | details"}) {
+		t.Errorf("unexpected case diagnostics %v", c.Diagnostics)
+	}
+	if len(r.Cases[0].Diagnostics) != 0 {
+		t.Errorf("expected no diagnostics for the first case but got %v", r.Cases[0].Diagnostics)
+	}
+}
+
+func TestConcurrentResults(t *testing.T) {
+	r := NewSuite("suite", "a test suite")
+	r.Writer = ioutil.Discard
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			desc := fmt.Sprint(i)
+			r.Ok(i%2 == 0, desc, "diagnostic for "+desc)
+		}(i)
+	}
+	wg.Wait()
+
+	if len(r.Cases) != 50 || r.Passed != 25 || r.Failed != 25 {
+		t.Fatalf("expected 50 cases, 25 passed and 25 failed but got %d, %d and %d",
+			len(r.Cases), r.Passed, r.Failed)
+	}
+	for _, c := range r.Cases {
+		if !reflect.DeepEqual(c.Diagnostics, []string{"diagnostic for " + c.Name}) {
+			t.Errorf("%s: unexpected diagnostics %v", c.Name, c.Diagnostics)
+		}
+	}
+}
+
+func TestPrintJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testSuite().PrintJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var out struct {
+		Name   string
+		Failed uint
+		Tests  []TestCase
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != "suite" || out.Failed != 1 || len(out.Tests) != 2 {
+		t.Errorf("unexpected JSON output %s", buf.String())
+	}
+	if out.Tests[1].Status != StatusFail || len(out.Tests[1].Diagnostics) != 2 {
+		t.Errorf("unexpected test %+v", out.Tests[1])
+	}
+}
+
+func TestPrintJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testSuite().PrintJUnit(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var suite junitTestSuite
+	if err := xml.Unmarshal(buf.Bytes(), &suite); err != nil {
+		t.Fatal(err)
+	}
+	if suite.Name != "suite" || suite.Tests != 2 || suite.Failures != 1 {
+		t.Errorf("unexpected suite %+v", suite)
+	}
+	if len(suite.Cases) != 2 {
+		t.Fatalf("expected 2 test cases but got %d", len(suite.Cases))
+	}
+	if suite.Cases[0].Failure != nil {
+		t.Errorf("expected the first case to pass but got %+v", suite.Cases[0].Failure)
+	}
+	f := suite.Cases[1].Failure
+	if f == nil || f.Text != "why it failed\nmore | details" {
+		t.Errorf("unexpected failure %+v", f)
+	}
+}
+
+func TestPrintMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testSuite().PrintMarkdown(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, expected := range []string{
+		"## suite\n",
+		"1 passed, 1 failed, 0 warnings, 0 skipped, 0 todo, 0 waived\n",
+		"| pass | first |\n",
+		"| fail | second |\n",
+		"### second\n\n```\nwhy it failed\nmore | details\n```\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in output:\n%s", expected, out)
+		}
+	}
+}
+
+func TestOutcomes(t *testing.T) {
+	testCases := []struct {
+		name   string
+		strict bool
+		record func(r *Results)
+		status string
+		counts [5]uint
+	}{
+		{"warn", false, func(r *Results) { r.Warn("w") }, StatusWarn, [5]uint{0, 0, 1, 0, 0}},
+		{"strict warn", true, func(r *Results) { r.Warn("w") }, StatusFail, [5]uint{0, 1, 0, 0, 0}},
+		{"skip", false, func(r *Results) { r.Skip("s", "why") }, StatusSkip, [5]uint{0, 0, 0, 1, 0}},
+		{"failing todo", false, func(r *Results) { r.Todo(false, "t") }, StatusTodo, [5]uint{0, 0, 0, 0, 1}},
+		{"passing todo", false, func(r *Results) { r.Todo(true, "t") }, StatusPass, [5]uint{1, 0, 0, 0, 0}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewSuite("suite", "a test suite")
+			r.Writer = ioutil.Discard
+			r.Strict = tc.strict
+			tc.record(r)
+
+			if len(r.Cases) != 1 || r.Cases[0].Status != tc.status {
+				t.Fatalf("expected one %s case but got %+v", tc.status, r.Cases)
+			}
+			counts := [5]uint{r.Passed, r.Failed, r.Warnings, r.Skipped, r.Todos}
+			if counts != tc.counts {
+				t.Errorf("expected counts %v but got %v", tc.counts, counts)
+			}
+		})
+	}
+}
+
+func TestPrintJUnitOutcomes(t *testing.T) {
+	r := NewSuite("suite", "a test suite")
+	r.Writer = ioutil.Discard
+	r.Warn("warned")
+	r.Diagnostic("grew")
+	r.Skip("skipped", "no packs")
+	r.Todo(false, "todo")
+
+	var buf bytes.Buffer
+	if err := r.PrintJUnit(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var suite junitTestSuite
+	if err := xml.Unmarshal(buf.Bytes(), &suite); err != nil {
+		t.Fatal(err)
+	}
+
+	if suite.Failures != 0 || suite.Skipped != 2 {
+		t.Errorf("expected 0 failures and 2 skipped but got %d and %d", suite.Failures, suite.Skipped)
+	}
+	if c := suite.Cases[0]; c.Failure != nil || c.Skipped != nil || c.SystemOut != "warning\ngrew" {
+		t.Errorf("unexpected warning case %+v", c)
+	}
+	if c := suite.Cases[1]; c.Skipped == nil || c.Skipped.Message != "no packs" {
+		t.Errorf("unexpected skipped case %+v", c)
+	}
+	if c := suite.Cases[2]; c.Skipped == nil || c.Skipped.Message != "todo" {
+		t.Errorf("unexpected todo case %+v", c)
+	}
+}
+
+func TestPrintUnknownFormat(t *testing.T) {
+	if err := testSuite().Print(ioutil.Discard, "yaml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
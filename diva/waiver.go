@@ -0,0 +1,120 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diva
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Waiver accepts the failure of the tests of Suite described by Test, or
+// matching the regular expression Pattern, until the Expires date. Reason
+// documents why the failure is accepted and Ticket tracks fixing it.
+type Waiver struct {
+	Suite   string    `toml:"suite"`
+	Test    string    `toml:"test"`
+	Pattern string    `toml:"pattern"`
+	Expires time.Time `toml:"expires"`
+	Reason  string    `toml:"reason"`
+	Ticket  string    `toml:"ticket"`
+	re      *regexp.Regexp
+}
+
+// waiverFile is the layout of a waiver file, a TOML file with a [[waiver]]
+// table per waiver:
+//
+//	[[waiver]]
+//	  suite = "bundle-verify"
+//	  test = "no deleted package bundles"
+//	  expires = 2019-01-31
+//	  reason = "pundle removed on purpose"
+//	  ticket = "https://github.com/clearlinux/clr-bundles/issues/1"
+type waiverFile struct {
+	Waivers []Waiver `toml:"waiver"`
+}
+
+// LoadWaivers reads the waiver file at path
+func LoadWaivers(path string) ([]Waiver, error) {
+	var f waiverFile
+	md, err := toml.DecodeFile(path, &f)
+	if err != nil {
+		return nil, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("%s: unknown key %s", path, undecoded[0])
+	}
+
+	for i := range f.Waivers {
+		w := &f.Waivers[i]
+		switch {
+		case w.Suite == "":
+			return nil, fmt.Errorf("%s: waiver %d has no suite", path, i+1)
+		case (w.Test == "") == (w.Pattern == ""):
+			return nil, fmt.Errorf("%s: waiver %d needs either a test or a pattern", path, i+1)
+		case w.Expires.IsZero():
+			return nil, fmt.Errorf("%s: waiver %d has no expiry", path, i+1)
+		case strings.TrimSpace(w.Reason) == "":
+			return nil, fmt.Errorf("%s: waiver %d has no reason", path, i+1)
+		}
+		if w.Pattern != "" {
+			if w.re, err = regexp.Compile(w.Pattern); err != nil {
+				return nil, fmt.Errorf("%s: waiver %d: %v", path, i+1, err)
+			}
+		}
+	}
+	return f.Waivers, nil
+}
+
+// matches returns whether w applies to the test of suite with description
+func (w *Waiver) matches(suite, description string) bool {
+	if w.Suite != suite {
+		return false
+	}
+	if w.Pattern == "" {
+		return w.Test == description
+	}
+	if w.re == nil {
+		var err error
+		if w.re, err = regexp.Compile(w.Pattern); err != nil {
+			return false
+		}
+	}
+	return w.re.MatchString(description)
+}
+
+// expired returns whether w no longer applies at now
+func (w *Waiver) expired(now time.Time) bool {
+	return !now.Before(w.Expires)
+}
+
+// target returns the test description or pattern of w
+func (w *Waiver) target() string {
+	if w.Test != "" {
+		return w.Test
+	}
+	return w.Pattern
+}
+
+// String returns the reason of w along with its ticket
+func (w *Waiver) String() string {
+	if w.Ticket == "" {
+		return w.Reason
+	}
+	return fmt.Sprintf("%s (%s)", w.Reason, w.Ticket)
+}
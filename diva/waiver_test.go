@@ -0,0 +1,147 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diva
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadWaivers(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{"valid", `
+[[waiver]]
+  suite = "bundle-verify"
+  test = "no deleted package bundles"
+  expires = 2019-01-31
+  reason = "pundle removed on purpose"
+  ticket = "BUG-1"
+
+[[waiver]]
+  suite = "updatecontent"
+  pattern = "^delta pack content correct for kernel-"
+  expires = 2019-01-31
+  reason = "kernel packs are rebuilt"
+`, true},
+		{"no suite", `
+[[waiver]]
+  test = "no deleted package bundles"
+  expires = 2019-01-31
+  reason = "pundle removed on purpose"
+`, false},
+		{"test and pattern", `
+[[waiver]]
+  suite = "bundle-verify"
+  test = "no deleted package bundles"
+  pattern = "deleted"
+  expires = 2019-01-31
+  reason = "pundle removed on purpose"
+`, false},
+		{"no expiry", `
+[[waiver]]
+  suite = "bundle-verify"
+  test = "no deleted package bundles"
+  reason = "pundle removed on purpose"
+`, false},
+		{"no reason", `
+[[waiver]]
+  suite = "bundle-verify"
+  test = "no deleted package bundles"
+  expires = 2019-01-31
+`, false},
+		{"bad pattern", `
+[[waiver]]
+  suite = "updatecontent"
+  pattern = "kernel-("
+  expires = 2019-01-31
+  reason = "kernel packs are rebuilt"
+`, false},
+	}
+
+	dir, err := ioutil.TempDir("", "waivers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, "waivers.toml")
+			if err := ioutil.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			w, err := LoadWaivers(path)
+			if (err == nil) != tc.valid {
+				t.Fatalf("expected valid %v but got error %v", tc.valid, err)
+			}
+			if tc.valid && len(w) != 2 {
+				t.Errorf("expected 2 waivers but got %d", len(w))
+			}
+		})
+	}
+}
+
+func TestWaivedResults(t *testing.T) {
+	tomorrow := time.Now().AddDate(0, 0, 1)
+	yesterday := time.Now().AddDate(0, 0, -1)
+
+	r := NewSuite("updatecontent", "a test suite")
+	r.Writer = ioutil.Discard
+	r.Waivers = []Waiver{
+		{Suite: "updatecontent", Test: "waived", Expires: tomorrow, Reason: "known", Ticket: "BUG-1"},
+		{Suite: "updatecontent", Pattern: "^kernel-", Expires: tomorrow, Reason: "rebuilt"},
+		{Suite: "updatecontent", Test: "expired", Expires: yesterday, Reason: "old"},
+		{Suite: "bloat", Test: "other suite", Expires: tomorrow, Reason: "other"},
+	}
+
+	r.Ok(false, "waived")
+	r.Ok(false, "kernel-native")
+	r.Ok(true, "kernel-lts")
+	r.Ok(false, "expired")
+	r.Ok(false, "other suite")
+
+	expected := []string{StatusWaived, StatusWaived, StatusPass, StatusFail, StatusFail}
+	for i, c := range r.Cases {
+		if c.Status != expected[i] {
+			t.Errorf("%s: expected %s but got %s", c.Name, expected[i], c.Status)
+		}
+	}
+	if r.Cases[0].Reason != "waived: known (BUG-1)" {
+		t.Errorf("unexpected reason %q", r.Cases[0].Reason)
+	}
+	if len(r.Cases[3].Diagnostics) != 1 {
+		t.Errorf("expected a diagnostic about the expired waiver but got %v", r.Cases[3].Diagnostics)
+	}
+	if r.Waived != 2 || r.Failed != 2 || r.Passed != 1 {
+		t.Errorf("expected 2 waived, 2 failed and 1 passed but got %d, %d and %d", r.Waived, r.Failed, r.Passed)
+	}
+
+	r.CheckWaivers()
+	if r.Failed != 3 {
+		t.Fatalf("expected the expired waiver to fail but got %d failures", r.Failed)
+	}
+	if c := r.Cases[len(r.Cases)-1]; c.Name != "waiver for expired has not expired" {
+		t.Errorf("unexpected expired waiver test %q", c.Name)
+	}
+}
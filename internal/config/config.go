@@ -34,19 +34,49 @@ type mixConfig struct {
 	MixWorkSpace string `toml:"workspace"`
 }
 
-// pathConfig defines paths to various data used by diva
+// pathConfig defines paths to various data used by diva. Keyring is an OpenPGP
+// public keyring, armored or binary, holding the keys RPMs must be signed with.
+// BloatPolicy is a TOML file with the bundle size limits and exemptions of the
+// bloat check, and Waivers a TOML file with the accepted failures of checks.
 type pathConfig struct {
 	BundleDefsRepo string `toml:"bundle_repository"`
 	LocalRPMRepo   string `toml:"local_rpms"`
 	CacheLocation  string `toml:"cache"`
+	Keyring        string `toml:"keyring"`
+	BloatPolicy    string `toml:"bloat_policy"`
+	Waivers        string `toml:"waivers"`
+}
+
+// storageConfig defines the backend used to store imported package information.
+// Backend may be either "redis" or "bolt". The bolt backend keeps all data in a
+// single file under the cache location and needs no running server.
+type storageConfig struct {
+	Backend string `toml:"backend"`
+}
+
+// redisConfig defines how the redis storage backend connects to its
+// redis-server. Address is a host:port pair and is ignored when Socket is set.
+// Timeout is in seconds, 0 means no timeout. When Spawn is true diva starts a
+// private redis-server listening on a socket in the cache location, shared by
+// the diva processes using that cache and stopped when the last of them is
+// done, and Address, Socket and Password are ignored.
+type redisConfig struct {
+	Address  string `toml:"address"`
+	Socket   string `toml:"socket"`
+	Password string `toml:"password"`
+	DB       int    `toml:"db"`
+	Timeout  uint   `toml:"timeout"`
+	Spawn    bool   `toml:"spawn"`
 }
 
 // Config struct that defines the layout of the configuration file
 type Config struct {
-	Mixer         mixConfig  `toml:"mixer"`
-	Paths         pathConfig `toml:"paths"`
-	UpstreamURL   string     `toml:"upstream_url"`
-	BundleDefsURL string     `toml:"bundles_url"`
+	Mixer         mixConfig     `toml:"mixer"`
+	Paths         pathConfig    `toml:"paths"`
+	Storage       storageConfig `toml:"storage"`
+	Redis         redisConfig   `toml:"redis"`
+	UpstreamURL   string        `toml:"upstream_url"`
+	BundleDefsURL string        `toml:"bundles_url"`
 }
 
 func defaultConf() Config {
@@ -59,6 +89,15 @@ func defaultConf() Config {
 			filepath.Join(ws, "projects/clr-bundles"),
 			filepath.Join(ws, "repo"),
 			filepath.Join(ws, "data"),
+			"",
+			"",
+			"",
+		},
+		storageConfig{
+			"redis",
+		},
+		redisConfig{
+			Address: "localhost:6379",
 		},
 		upstreamURL,
 		bundleDefsURL,
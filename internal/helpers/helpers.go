@@ -60,6 +60,27 @@ func download(url string) (*http.Response, error) {
 	return resp, nil
 }
 
+// ContentLength returns the size of the file at url from a HEAD request, and
+// false if the server does not have the file
+func ContentLength(url string) (int64, bool, error) {
+	resp, err := http.Head(url)
+	if err != nil {
+		return 0, false, err
+	}
+	_ = resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return 0, false, nil
+	case resp.StatusCode != http.StatusOK:
+		return 0, false, fmt.Errorf("Head %s replied: %d (%s)",
+			url, resp.StatusCode, http.StatusText(resp.StatusCode))
+	case resp.ContentLength < 0:
+		return 0, false, fmt.Errorf("Head %s replied without a content length", url)
+	}
+	return resp.ContentLength, true, nil
+}
+
 // Download will attempt to download a from URL to the given filename. Does not
 // try to extract the file, simply lays it on disk. Use this function if you
 // know the file at url is not compressed or if you want to download a
@@ -287,12 +308,30 @@ func PrintComplete(message string, fmts ...interface{}) {
 	fmt.Fprintln(os.Stderr, fmt.Sprintf(fmt.Sprintf("    %s", message), fmts...))
 }
 
+// exitHooks are run by Exit before the program exits
+var exitHooks []func()
+
+// OnExit registers f to be run when the program exits through Exit or
+// FailIfErr, which do not run deferred calls
+func OnExit(f func()) {
+	exitHooks = append(exitHooks, f)
+}
+
+// Exit runs the functions registered with OnExit, the most recent first, and
+// exits the program with code
+func Exit(code int) {
+	for i := len(exitHooks) - 1; i >= 0; i-- {
+		exitHooks[i]()
+	}
+	os.Exit(code)
+}
+
 // FailIfErr prints the error and exits the program with an error code if err
 // is not nil
 func FailIfErr(err error) {
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: ERROR: %s\n", os.Args[0], err)
-		os.Exit(1)
+		Exit(1)
 	}
 }
 
@@ -0,0 +1,241 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltStore keeps all pkginfo data in a single bolt database file. Each repo
+// is a top-level bucket keyed the same way as the redis backend
+// (<name><version><type>), containing the repo URI and a nested packages
+// bucket that maps each package name to its JSON encoded RPM. The reverse
+// indexes are nested buckets named after the index with empty values under
+// <item>\x00<package> keys, so a lookup is a prefix scan.
+type boltStore struct {
+	db *bolt.DB
+}
+
+var (
+	boltURIKey      = []byte("uri")
+	boltPackagesKey = []byte("packages")
+)
+
+func newBoltStore(path string) (*boltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	// bolt holds an exclusive lock on the file while it is open, time out
+	// rather than hang forever if another diva process is using it
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func boltRepoKey(repo *Repo) []byte {
+	return []byte(fmt.Sprintf("%s%s%s", repo.Name, repo.Version, repo.Type))
+}
+
+func boltIndexKey(item, pkg string) []byte {
+	return []byte(item + "\x00" + pkg)
+}
+
+// updateIndexesBolt adds or, if del is set, removes the reverse index entries
+// for rpm in the repo bucket
+func updateIndexesBolt(rb *bolt.Bucket, rpm *RPM, del bool) error {
+	for index, items := range reverseIndexItems(rpm) {
+		b, err := rb.CreateBucketIfNotExists([]byte(index))
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if del {
+				err = b.Delete(boltIndexKey(item, rpm.Name))
+			} else {
+				err = b.Put(boltIndexKey(item, rpm.Name), []byte{})
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// putRPMBolt stores rpm in the packages bucket of the repo bucket and updates
+// the reverse indexes, replacing any entries for a previously stored version
+func putRPMBolt(rb *bolt.Bucket, rpm *RPM) error {
+	pkgs := rb.Bucket(boltPackagesKey)
+	if old := pkgs.Get([]byte(rpm.Name)); old != nil {
+		p := &RPM{}
+		if err := json.Unmarshal(old, p); err != nil {
+			return err
+		}
+		if err := updateIndexesBolt(rb, p, true); err != nil {
+			return err
+		}
+	}
+
+	v, err := json.Marshal(rpm)
+	if err != nil {
+		return err
+	}
+	if err = pkgs.Put([]byte(rpm.Name), v); err != nil {
+		return err
+	}
+	return updateIndexesBolt(rb, rpm, false)
+}
+
+// createRepoBucketBolt returns the repo bucket, creating it along with its
+// packages bucket and storing the repo URI if needed
+func createRepoBucketBolt(tx *bolt.Tx, repo *Repo) (*bolt.Bucket, error) {
+	rb, err := tx.CreateBucketIfNotExists(boltRepoKey(repo))
+	if err != nil {
+		return nil, err
+	}
+	if err = rb.Put(boltURIKey, []byte(repo.URI)); err != nil {
+		return nil, err
+	}
+	if _, err = rb.CreateBucketIfNotExists(boltPackagesKey); err != nil {
+		return nil, err
+	}
+	return rb, nil
+}
+
+// StoreRepo stores all data in repo to the bolt database
+func (s *boltStore) StoreRepo(repo *Repo) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		rb, err := createRepoBucketBolt(tx, repo)
+		if err != nil {
+			return err
+		}
+		for i := range repo.Packages {
+			if err = putRPMBolt(rb, repo.Packages[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// StoreRPM stores the rpm under the repo bucket in the bolt database
+func (s *boltStore) StoreRPM(repo *Repo, rpm *RPM) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		rb, err := createRepoBucketBolt(tx, repo)
+		if err != nil {
+			return err
+		}
+		return putRPMBolt(rb, rpm)
+	})
+}
+
+// GetRepo retrieves all packages associated with the given repo from the bolt
+// database
+func (s *boltStore) GetRepo(repo *Repo) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		rb := tx.Bucket(boltRepoKey(repo))
+		if rb == nil {
+			return nil
+		}
+		pkgs := rb.Bucket(boltPackagesKey)
+		if pkgs == nil {
+			return nil
+		}
+		return pkgs.ForEach(func(k, v []byte) error {
+			p := &RPM{}
+			if err := json.Unmarshal(v, p); err != nil {
+				return err
+			}
+			repo.Packages = appendUniqueRPMName(repo.Packages, p)
+			return nil
+		})
+	})
+}
+
+// GetRPM retrieves the named rpm from the repo bucket in the bolt database
+func (s *boltStore) GetRPM(repo *Repo, rpm string) (*RPM, error) {
+	var p *RPM
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var v []byte
+		if rb := tx.Bucket(boltRepoKey(repo)); rb != nil {
+			if pkgs := rb.Bucket(boltPackagesKey); pkgs != nil {
+				v = pkgs.Get([]byte(rpm))
+			}
+		}
+		if v == nil {
+			return fmt.Errorf("unable to find %s RPM in %s repo", rpm, repo.Name)
+		}
+		p = &RPM{}
+		return json.Unmarshal(v, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// lookupBolt returns the sorted package names listed under item in the named
+// reverse index of the repo
+func (s *boltStore) lookupBolt(repo *Repo, index, item string) ([]string, error) {
+	var names []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		rb := tx.Bucket(boltRepoKey(repo))
+		if rb == nil {
+			return nil
+		}
+		b := rb.Bucket([]byte(index))
+		if b == nil {
+			return nil
+		}
+
+		prefix := boltIndexKey(item, "")
+		c := b.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			names = append(names, string(k[len(prefix):]))
+		}
+		return nil
+	})
+	return names, err
+}
+
+// FileOwners returns the names of the RPMs in the repo that ship path
+func (s *boltStore) FileOwners(repo *Repo, path string) ([]string, error) {
+	return s.lookupBolt(repo, ownersIndex, path)
+}
+
+// Providers returns the names of the RPMs in the repo that provide capability
+func (s *boltStore) Providers(repo *Repo, capability string) ([]string, error) {
+	return s.lookupBolt(repo, providesIndex, capability)
+}
+
+// Requirers returns the names of the RPMs in the repo that require capability
+func (s *boltStore) Requirers(repo *Repo, capability string) ([]string, error) {
+	return s.lookupBolt(repo, requiresIndex, capability)
+}
+
+// Close closes the underlying bolt database
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
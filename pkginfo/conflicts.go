@@ -0,0 +1,119 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"sort"
+)
+
+// FileConflict is a path shipped by more than one RPM where the RPMs disagree
+// on its type, content, permissions or ownership. Files maps the name of each
+// conflicting RPM to the file it ships at Path, and Differences lists the
+// attributes that differ.
+type FileConflict struct {
+	Path        string
+	Files       map[string]*File
+	Differences []string
+}
+
+// fileOwner is a single file and the name of the RPM that ships it
+type fileOwner struct {
+	rpm  string
+	file *File
+}
+
+// fileDifferences returns the attributes that differ between a and b.
+// Attributes that are empty on either side were not recorded at import time,
+// for example when only the repo metadata was imported, and are not compared.
+func fileDifferences(a, b *File) []string {
+	if a.Type != b.Type {
+		return []string{"type"}
+	}
+
+	var diffs []string
+	differ := func(x, y string) bool {
+		return x != "" && y != "" && x != y
+	}
+	switch {
+	case a.Type == 'F' && differ(a.Hash, b.Hash):
+		diffs = append(diffs, "content")
+	case a.Type == 'L' && differ(a.SymlinkTarget, b.SymlinkTarget):
+		diffs = append(diffs, "symlink target")
+	}
+	if differ(a.Permissions, b.Permissions) {
+		diffs = append(diffs, "permissions")
+	}
+	if differ(a.Owner, b.Owner) {
+		diffs = append(diffs, "owner")
+	}
+	if differ(a.Group, b.Group) {
+		diffs = append(diffs, "group")
+	}
+	return diffs
+}
+
+// FileConflicts returns every path in repo shipped by more than one RPM with
+// differing type, content, permissions or ownership, sorted by path. When
+// coinstalled is not nil only RPMs for which it returns true can conflict with
+// each other, which allows limiting the check to RPMs installed together by a
+// bundle.
+func FileConflicts(repo *Repo, coinstalled func(a, b string) bool) []FileConflict {
+	owners := make(map[string][]fileOwner)
+	for _, r := range repo.Packages {
+		for _, f := range r.Files {
+			owners[f.Name] = append(owners[f.Name], fileOwner{rpm: r.Name, file: f})
+		}
+	}
+
+	var conflicts []FileConflict
+	for path, fo := range owners {
+		if len(fo) < 2 {
+			continue
+		}
+
+		c := FileConflict{Path: path, Files: make(map[string]*File)}
+		seen := make(map[string]bool)
+		for i := range fo {
+			for j := i + 1; j < len(fo); j++ {
+				diffs := fileDifferences(fo[i].file, fo[j].file)
+				if len(diffs) == 0 {
+					continue
+				}
+				if coinstalled != nil && !coinstalled(fo[i].rpm, fo[j].rpm) {
+					continue
+				}
+
+				c.Files[fo[i].rpm] = fo[i].file
+				c.Files[fo[j].rpm] = fo[j].file
+				for _, d := range diffs {
+					if !seen[d] {
+						seen[d] = true
+						c.Differences = append(c.Differences, d)
+					}
+				}
+			}
+		}
+
+		if len(c.Files) > 0 {
+			sort.Strings(c.Differences)
+			conflicts = append(conflicts, c)
+		}
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Path < conflicts[j].Path
+	})
+	return conflicts
+}
@@ -0,0 +1,75 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFileConflicts(t *testing.T) {
+	repo := &Repo{
+		Packages: []*RPM{
+			{
+				Name: "a",
+				Files: []*File{
+					{Name: "/usr/bin/tool", Type: 'F', Hash: "111", Permissions: "-rwxr-xr-x"},
+					{Name: "/usr/share/dir", Type: 'D', Permissions: "drwxr-xr-x", Owner: "root"},
+					{Name: "/usr/share/same", Type: 'F', Hash: "333", Permissions: "-rw-r--r--"},
+					{Name: "/usr/lib/link", Type: 'L', SymlinkTarget: "one"},
+					{Name: "/usr/share/meta", Type: 'F'},
+				},
+			},
+			{
+				Name: "b",
+				Files: []*File{
+					{Name: "/usr/bin/tool", Type: 'F', Hash: "222", Permissions: "-rwxr-xr-x"},
+					{Name: "/usr/share/dir", Type: 'D', Permissions: "drwx------", Owner: "root"},
+					{Name: "/usr/share/same", Type: 'F', Hash: "333", Permissions: "-rw-r--r--"},
+					{Name: "/usr/lib/link", Type: 'L', SymlinkTarget: "two"},
+					{Name: "/usr/share/meta", Type: 'F'},
+				},
+			},
+			{
+				Name: "c",
+				Files: []*File{
+					{Name: "/usr/bin/tool", Type: 'D'},
+				},
+			},
+		},
+	}
+
+	conflicts := FileConflicts(repo, nil)
+	var got []string
+	for _, c := range conflicts {
+		got = append(got, c.Path+": "+strings.Join(c.Differences, ","))
+	}
+	expected := []string{
+		"/usr/bin/tool: content,type",
+		"/usr/lib/link: symlink target",
+		"/usr/share/dir: permissions",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected conflicts\n%v\nbut got\n%v", expected, got)
+	}
+
+	// c is never installed with the others, so only a and b conflict
+	conflicts = FileConflicts(repo, func(x, y string) bool {
+		return x != "c" && y != "c"
+	})
+	if len(conflicts) != 3 || len(conflicts[0].Files) != 2 || conflicts[0].Files["c"] != nil {
+		t.Errorf("expected c to be excluded but got %+v", conflicts)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"sort"
+	"strings"
+)
+
+// provider is a single provides entry and the RPM it belongs to
+type provider struct {
+	rpm *RPM
+	dep Dependency
+}
+
+// ProvidesIndex maps the provides and file paths of every RPM in a repo to the
+// RPMs that provide them so requirements can be resolved without scanning the
+// whole repo for each one.
+type ProvidesIndex struct {
+	provides map[string][]provider
+	files    map[string][]*RPM
+}
+
+// UnresolvedDep is a runtime requirement of RPM that was not resolved against
+// the RPMs in the repo
+type UnresolvedDep struct {
+	RPM         *RPM
+	Requirement Dependency
+}
+
+// NewProvidesIndex builds a ProvidesIndex over all RPMs in repo
+func NewProvidesIndex(repo *Repo) *ProvidesIndex {
+	idx := &ProvidesIndex{
+		provides: make(map[string][]provider),
+		files:    make(map[string][]*RPM),
+	}
+	for _, r := range repo.Packages {
+		idx.Add(r)
+	}
+	return idx
+}
+
+// Add adds the provides and files of r to the index
+func (idx *ProvidesIndex) Add(r *RPM) {
+	for _, p := range r.Provides {
+		idx.provides[p.Name] = append(idx.provides[p.Name], provider{rpm: r, dep: p})
+	}
+	for _, f := range r.Files {
+		idx.files[f.Name] = append(idx.files[f.Name], r)
+	}
+}
+
+// WhatProvides returns every RPM that satisfies req, taking version
+// constraints into account. A requirement on an absolute path is also
+// satisfied by any RPM that ships a file at that path.
+func (idx *ProvidesIndex) WhatProvides(req Dependency) []*RPM {
+	var rpms []*RPM
+	seen := make(map[*RPM]bool)
+	for _, p := range idx.provides[req.Name] {
+		if !seen[p.rpm] && p.dep.Overlaps(req) {
+			seen[p.rpm] = true
+			rpms = append(rpms, p.rpm)
+		}
+	}
+
+	if strings.HasPrefix(req.Name, "/") {
+		for _, r := range idx.files[req.Name] {
+			if !seen[r] {
+				seen[r] = true
+				rpms = append(rpms, r)
+			}
+		}
+	}
+
+	return rpms
+}
+
+// isInternalRequirement reports whether req is resolved by something other than
+// the packages in the repo. rpmlib() requirements are features of rpm itself.
+func isInternalRequirement(req Dependency) bool {
+	return strings.HasPrefix(req.Name, "rpmlib(")
+}
+
+// IsRichDependency reports whether req is a rich dependency such as
+// "(foo if bar)", a boolean expression that rpm evaluates at install time and
+// that can not be looked up by name
+func IsRichDependency(req Dependency) bool {
+	return strings.HasPrefix(req.Name, "(")
+}
+
+// Resolves reports whether req is satisfied by any RPM in the index. Rich
+// dependencies are never resolved by the index.
+func (idx *ProvidesIndex) Resolves(req Dependency) bool {
+	return isInternalRequirement(req) || len(idx.WhatProvides(req)) > 0
+}
+
+// sortDeps sorts deps by package name and requirement
+func sortDeps(deps []UnresolvedDep) {
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].RPM.Name != deps[j].RPM.Name {
+			return deps[i].RPM.Name < deps[j].RPM.Name
+		}
+		return deps[i].Requirement.String() < deps[j].Requirement.String()
+	})
+}
+
+// UnresolvedRequires returns every runtime requirement of the RPMs in repo that
+// no RPM in repo satisfies, and every rich requirement, which is not evaluated
+// and so neither resolved nor unresolved. Both are sorted by package name and
+// requirement.
+func UnresolvedRequires(repo *Repo) ([]UnresolvedDep, []UnresolvedDep) {
+	idx := NewProvidesIndex(repo)
+
+	var unresolved, rich []UnresolvedDep
+	for _, r := range repo.Packages {
+		for _, req := range r.Requires {
+			switch {
+			case IsRichDependency(req):
+				rich = append(rich, UnresolvedDep{RPM: r, Requirement: req})
+			case !idx.Resolves(req):
+				unresolved = append(unresolved, UnresolvedDep{RPM: r, Requirement: req})
+			}
+		}
+	}
+
+	sortDeps(unresolved)
+	sortDeps(rich)
+	return unresolved, rich
+}
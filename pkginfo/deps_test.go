@@ -0,0 +1,79 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import "testing"
+
+func TestUnresolvedRequires(t *testing.T) {
+	repo := &Repo{
+		Packages: []*RPM{
+			{
+				Name:     "python3",
+				SRPMName: "python3",
+				Provides: []Dependency{
+					{Name: "python3", Flags: FlagEQ, EVR: EVR{"0", "3.7.0", "1"}},
+				},
+				Files: []*File{{Name: "/usr/bin/python3", Type: 'F'}},
+			},
+			{
+				Name:     "app",
+				SRPMName: "app",
+				Requires: []Dependency{
+					{Name: "/usr/bin/python3"},
+					{Name: "python3", Flags: FlagGE, EVR: EVR{Version: "3.6"}},
+					{Name: "python3", Flags: FlagGE, EVR: EVR{Version: "3.8"}},
+					{Name: "/usr/bin/perl"},
+					{Name: "libmissing.so.1()(64bit)"},
+					{Name: "rpmlib(CompressedFileNames)", Flags: FlagLE, EVR: EVR{Version: "3.0.4"}},
+					{Name: "(python3 or perl)"},
+				},
+			},
+		},
+	}
+
+	unresolved, rich := UnresolvedRequires(repo)
+
+	var got []string
+	for _, u := range unresolved {
+		if u.RPM.Name != "app" {
+			t.Errorf("unexpected unresolved requirement from %s", u.RPM.Name)
+		}
+		got = append(got, u.Requirement.String())
+	}
+
+	expected := []string{"/usr/bin/perl", "libmissing.so.1()(64bit)", "python3 >= 3.8"}
+	if !sameStrings(got, expected) {
+		t.Errorf("expected unresolved %v but got %v", expected, got)
+	}
+	if len(rich) != 1 || rich[0].Requirement.Name != "(python3 or perl)" {
+		t.Errorf("expected the rich requirement to be reported but got %v", rich)
+	}
+}
+
+func TestWhatProvides(t *testing.T) {
+	a := &RPM{Name: "a", Provides: []Dependency{{Name: "foo"}}}
+	b := &RPM{Name: "b", Provides: []Dependency{
+		{Name: "foo", Flags: FlagEQ, EVR: EVR{"0", "2", "1"}},
+		{Name: "foo", Flags: FlagEQ, EVR: EVR{"0", "2", "1"}},
+	}}
+	idx := NewProvidesIndex(&Repo{Packages: []*RPM{a, b}})
+
+	if rpms := idx.WhatProvides(Dependency{Name: "foo"}); len(rpms) != 2 {
+		t.Errorf("expected 2 providers but got %d", len(rpms))
+	}
+	if rpms := idx.WhatProvides(Dependency{Name: "bar"}); len(rpms) != 0 {
+		t.Errorf("expected no providers but got %d", len(rpms))
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"sort"
+)
+
+// PackageDiff describes how a package changed between the repos of a
+// RepoDiff. FromLicense and ToLicense are only set when the license changed.
+type PackageDiff struct {
+	Name            string
+	FromEVR         EVR
+	ToEVR           EVR
+	FromLicense     string
+	ToLicense       string
+	AddedProvides   []string
+	RemovedProvides []string
+	AddedFiles      []string
+	RemovedFiles    []string
+}
+
+// RepoDiff is the difference between two versions of a repo. Added and
+// Removed list the packages only in one of the repos, with only ToEVR or
+// FromEVR set respectively. Packages in both are listed in Upgraded or
+// Downgraded when their version changed, or in Changed when only their
+// license, provides or files did.
+type RepoDiff struct {
+	From       string
+	To         string
+	Added      []PackageDiff
+	Removed    []PackageDiff
+	Upgraded   []PackageDiff
+	Downgraded []PackageDiff
+	Changed    []PackageDiff
+}
+
+// stringSetDiff returns the sorted elements only in b and only in a
+func stringSetDiff(a, b []string) ([]string, []string) {
+	inA := make(map[string]bool)
+	for _, s := range a {
+		inA[s] = true
+	}
+	inB := make(map[string]bool)
+	for _, s := range b {
+		inB[s] = true
+	}
+
+	var added, removed []string
+	for s := range inB {
+		if !inA[s] {
+			added = append(added, s)
+		}
+	}
+	for s := range inA {
+		if !inB[s] {
+			removed = append(removed, s)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// provideKey identifies a provide by its name and flags, leaving out its EVR,
+// so that the versioned provides of a package that every upgrade bumps, such
+// as its own name, do not show up as changed
+func provideKey(d Dependency) string {
+	if d.Flags == "" {
+		return d.Name
+	}
+	return d.Name + " " + flagOperator[d.Flags]
+}
+
+// provideSetDiff returns the sorted provides only in b and only in a, compared
+// by provideKey
+func provideSetDiff(a, b []Dependency) ([]string, []string) {
+	keys := func(deps []Dependency) map[string]bool {
+		m := make(map[string]bool)
+		for _, d := range deps {
+			m[provideKey(d)] = true
+		}
+		return m
+	}
+	only := func(deps []Dependency, other map[string]bool) []string {
+		var s []string
+		seen := make(map[string]bool)
+		for _, d := range deps {
+			if str := d.String(); !other[provideKey(d)] && !seen[str] {
+				seen[str] = true
+				s = append(s, str)
+			}
+		}
+		sort.Strings(s)
+		return s
+	}
+
+	return only(b, keys(a)), only(a, keys(b))
+}
+
+func fileNames(files []*File) []string {
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+// diffPackage returns the differences between the from and to versions of a
+// package and whether anything but the version changed
+func diffPackage(from, to *RPM) (PackageDiff, bool) {
+	d := PackageDiff{
+		Name:    to.Name,
+		FromEVR: from.EVR(),
+		ToEVR:   to.EVR(),
+	}
+	if from.License != to.License {
+		d.FromLicense = from.License
+		d.ToLicense = to.License
+	}
+	d.AddedProvides, d.RemovedProvides = provideSetDiff(from.Provides, to.Provides)
+	d.AddedFiles, d.RemovedFiles = stringSetDiff(fileNames(from.Files), fileNames(to.Files))
+
+	changed := d.ToLicense != d.FromLicense ||
+		len(d.AddedProvides)+len(d.RemovedProvides)+len(d.AddedFiles)+len(d.RemovedFiles) > 0
+	return d, changed
+}
+
+// DiffRepos returns the packages added, removed and changed from the from repo
+// to the to repo. Versions are compared with RPM version comparison, so a
+// package is only upgraded when dnf would upgrade it. Every list in the result
+// is sorted by package name.
+func DiffRepos(from, to *Repo) RepoDiff {
+	diff := RepoDiff{From: from.Version, To: to.Version}
+
+	fromPkgs := make(map[string]*RPM)
+	for _, r := range from.Packages {
+		fromPkgs[r.Name] = r
+	}
+	toPkgs := make(map[string]*RPM)
+	for _, r := range to.Packages {
+		toPkgs[r.Name] = r
+	}
+
+	for name, r := range fromPkgs {
+		if _, ok := toPkgs[name]; !ok {
+			diff.Removed = append(diff.Removed, PackageDiff{Name: name, FromEVR: r.EVR()})
+		}
+	}
+
+	for name, r := range toPkgs {
+		old, ok := fromPkgs[name]
+		if !ok {
+			diff.Added = append(diff.Added, PackageDiff{Name: name, ToEVR: r.EVR()})
+			continue
+		}
+
+		d, changed := diffPackage(old, r)
+		switch c := CompareEVR(d.FromEVR, d.ToEVR); {
+		case c < 0:
+			diff.Upgraded = append(diff.Upgraded, d)
+		case c > 0:
+			diff.Downgraded = append(diff.Downgraded, d)
+		case changed:
+			diff.Changed = append(diff.Changed, d)
+		}
+	}
+
+	for _, ds := range [][]PackageDiff{diff.Added, diff.Removed, diff.Upgraded, diff.Downgraded, diff.Changed} {
+		sort.Slice(ds, func(i, j int) bool {
+			return ds[i].Name < ds[j].Name
+		})
+	}
+	return diff
+}
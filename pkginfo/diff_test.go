@@ -0,0 +1,86 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func diffNames(diffs []PackageDiff) []string {
+	var names []string
+	for _, d := range diffs {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+func TestDiffRepos(t *testing.T) {
+	from := &Repo{
+		Version: "100",
+		Packages: []*RPM{
+			{Name: "same", Version: "1.0", Release: "1"},
+			{Name: "gone", Version: "1.0", Release: "1"},
+			{Name: "up", Version: "1.9", Release: "3",
+				Provides: []Dependency{{Name: "up", Flags: FlagEQ, EVR: EVR{"0", "1.9", "3"}}},
+				Files:    []*File{{Name: "/usr/bin/up"}, {Name: "/usr/bin/old"}}},
+			{Name: "down", Version: "2.0", Release: "1"},
+			{Name: "relicensed", Version: "1.0", Release: "1", License: "GPL-2.0"},
+			{Name: "provider", Version: "1.0", Release: "1",
+				Provides: []Dependency{{Name: "libold.so"}}},
+		},
+	}
+	to := &Repo{
+		Version: "110",
+		Packages: []*RPM{
+			{Name: "same", Version: "1.0", Release: "1"},
+			{Name: "new", Version: "0.1", Release: "1"},
+			{Name: "up", Version: "1.10", Release: "1",
+				Provides: []Dependency{{Name: "up", Flags: FlagEQ, EVR: EVR{"0", "1.10", "1"}}},
+				Files:    []*File{{Name: "/usr/bin/up"}, {Name: "/usr/bin/new"}}},
+			{Name: "down", Version: "2.0~rc1", Release: "2"},
+			{Name: "relicensed", Version: "1.0", Release: "1", License: "MIT"},
+			{Name: "provider", Version: "1.0", Release: "1",
+				Provides: []Dependency{{Name: "libnew.so", Flags: FlagEQ, EVR: EVR{Version: "2"}}}},
+		},
+	}
+
+	diff := DiffRepos(from, to)
+	testCases := []struct {
+		name     string
+		got      []string
+		expected []string
+	}{
+		{"added", diffNames(diff.Added), []string{"new"}},
+		{"removed", diffNames(diff.Removed), []string{"gone"}},
+		{"upgraded", diffNames(diff.Upgraded), []string{"up"}},
+		{"downgraded", diffNames(diff.Downgraded), []string{"down"}},
+		{"changed", diffNames(diff.Changed), []string{"provider", "relicensed"}},
+		{"added files", diff.Upgraded[0].AddedFiles, []string{"/usr/bin/new"}},
+		{"removed files", diff.Upgraded[0].RemovedFiles, []string{"/usr/bin/old"}},
+		{"added provides", diff.Changed[0].AddedProvides, []string{"libnew.so = 2"}},
+		{"removed provides", diff.Changed[0].RemovedProvides, []string{"libold.so"}},
+		{"upgraded provides", append(diff.Upgraded[0].AddedProvides, diff.Upgraded[0].RemovedProvides...), nil},
+		{"licenses", []string{diff.Changed[1].FromLicense, diff.Changed[1].ToLicense}, []string{"GPL-2.0", "MIT"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tc.got, tc.expected) {
+				t.Errorf("expected %v but got %v", tc.expected, tc.got)
+			}
+		})
+	}
+}
@@ -23,7 +23,6 @@ import (
 	"runtime"
 	"sync"
 
-	rpm "github.com/cavaliercoder/go-rpm"
 	"github.com/clearlinux/diva/internal/config"
 	"github.com/clearlinux/diva/internal/helpers"
 )
@@ -31,11 +30,12 @@ import (
 // config object used by GetUpstreamRepoFiles and called functions
 var c *config.Config
 
-// buildFileListsURL parses upstream repomd.xml file to find the filelists
-// file.  We cannot just look for the filelists file directly because a hash is
-// part of the filename. The repomd.xml file lists this file name so we can
-// construct the url using this value.
-func buildFilelistsURL(repo *Repo, workingDir string, update bool) (string, error) {
+// metadataURLs parses upstream repomd.xml file to find the metadata files. We
+// cannot just look for the metadata files directly because a hash is part of
+// the filename. The repomd.xml file lists these file names so we can construct
+// the urls using these values. The returned map is keyed by metadata type, for
+// example "primary" or "filelists".
+func metadataURLs(repo *Repo, workingDir string, update bool) (map[string]string, error) {
 	// download repomd.xml
 	repomdFile := filepath.Join(workingDir, "repomd.xml")
 	repomdURL := fmt.Sprintf("%s/repodata/repomd.xml", repo.URI)
@@ -47,7 +47,7 @@ func buildFilelistsURL(repo *Repo, workingDir string, update bool) (string, erro
 	if err != nil || update {
 		err = helpers.Download(repomdURL, repomdFile, update)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 	}
 
@@ -71,114 +71,72 @@ func buildFilelistsURL(repo *Repo, workingDir string, update bool) (string, erro
 
 	d, err := ioutil.ReadFile(repomdFile)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	v := new(repomd)
 	err = xml.Unmarshal([]byte(d), v)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	var path string
+	urls := make(map[string]string)
 	for _, section := range v.Data {
-		if section.Key == "filelists" {
-			path = section.Location.Path
-			break
-		}
+		urls[section.Key] = fmt.Sprintf("%s/%s", repo.URI, section.Location.Path)
 	}
 
-	return fmt.Sprintf("%s/%s", repo.URI, path), nil
+	return urls, nil
 }
 
-// If a version changed from what was in the cache, return true, otherwise false
-func versionChanged(rpmURL, cacheDir string, cRPM *rpm.PackageFile) bool {
-	newRPM, err := rpm.OpenPackageFile(rpmURL)
-	if err != nil {
-		return true
-	}
-	// VersionCompare returns 1 if newRPM is more recent, -1 if cRPM is more recent
-	// and 0, if they're the same.
-	return rpm.VersionCompare(newRPM, cRPM) == 1
-}
-
-// If a RPM needs to be redownloaded, return true, otherwise return false
-func updateCache(cachedRPMs []*rpm.PackageFile, rpmName, rpmURL, cacheDir string) bool {
-	for _, cRPM := range cachedRPMs {
-		if cRPM.Name() == rpmName {
-			if !versionChanged(rpmURL, cacheDir, cRPM) {
-				return false
-			}
-			staleRPM := fmt.Sprintf("%s/%s-%s-%s.%s.rpm",
-				cacheDir,
-				cRPM.Name(),
-				cRPM.Version(),
-				cRPM.Release(),
-				cRPM.Architecture(),
-			)
-			if err := os.Remove(staleRPM); err != nil {
-				return true
-			}
-		}
+// removeStaleRPMs removes cached RPMs that are no longer listed in the repo
+// metadata, usually because a newer version replaced them upstream
+func removeStaleRPMs(cacheDir string, rpms []*RPM) error {
+	current := make(map[string]bool)
+	for _, r := range rpms {
+		current[filepath.Base(r.Location)] = true
 	}
-	return true
-}
 
-func buildPackageURLs(repo *Repo, flistsPath, workingDir string, update bool) ([]string, error) {
-	// <filelists xmlns="http://linux.duke.edu/metadata/filelists" packages="7436">
-	//   <package ... name="pkgname" arch="x86_64">
-	//     <version ... ver="ver" rel="rel"/>
-	//     ...
-	//   </package>
-	type verRel struct {
-		V string `xml:"ver,attr"`
-		R string `xml:"rel,attr"`
-	}
-	type packageInfo struct {
-		Name string `xml:"name,attr"`
-		VR   verRel `xml:"version"`
-		Arch string `xml:"arch,attr"`
+	cached, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		return err
 	}
-	type filelists struct {
-		XMLName  xml.Name      `xml:"filelists"`
-		Packages []packageInfo `xml:"package"`
+	for _, fi := range cached {
+		if filepath.Ext(fi.Name()) != ".rpm" || current[fi.Name()] {
+			continue
+		}
+		if err = os.Remove(filepath.Join(cacheDir, fi.Name())); err != nil {
+			return err
+		}
 	}
 
-	d, err := ioutil.ReadFile(flistsPath)
-	if err != nil {
-		return []string{}, err
-	}
+	return nil
+}
 
-	v := new(filelists)
-	err = xml.Unmarshal(d, v)
+// listPackages returns the RPMs listed in the primary metadata at primaryPath,
+// removing any cached RPMs that are no longer listed when updating
+func listPackages(primaryPath, workingDir string, update bool) ([]*RPM, error) {
+	_, rpms, err := parsePrimary(primaryPath)
 	if err != nil {
-		return []string{}, err
+		return nil, err
 	}
 
 	cacheDir := filepath.Join(workingDir, "packages")
 	if err = os.MkdirAll(cacheDir, 0755); err != nil {
-		return []string{}, err
-	}
-	cachedRPMs, err := rpm.OpenPackageFiles(cacheDir)
-	if err != nil {
-		return []string{}, err
+		return nil, err
 	}
 
-	packages := []string{}
-	url := fmt.Sprintf("%s/Packages", repo.URI)
-	for _, p := range v.Packages {
-		rpmURL := fmt.Sprintf("%s/%s-%s-%s.%s.rpm", url, p.Name, p.VR.V, p.VR.R, p.Arch)
-		if update {
-			if !updateCache(cachedRPMs, p.Name, rpmURL, cacheDir) {
-				continue
-			}
+	if update {
+		if err = removeStaleRPMs(cacheDir, rpms); err != nil {
+			return nil, err
 		}
-		packages = append(packages, rpmURL)
 	}
 
-	return packages, nil
+	return rpms, nil
 }
 
-func downloadAllRPMs(packages []string, workingDir string) error {
+// downloadAllRPMs downloads rpms from the repo to the packages directory in
+// workingDir. Cached RPMs are only downloaded again if they do not match the
+// checksum in the repo metadata.
+func downloadAllRPMs(repo *Repo, rpms []*RPM, workingDir string) error {
 	// ensure directory in cache exists
 	outPath := filepath.Join(workingDir, "packages")
 	if err := os.MkdirAll(outPath, 0755); err != nil {
@@ -187,20 +145,15 @@ func downloadAllRPMs(packages []string, workingDir string) error {
 	var wg sync.WaitGroup
 	workers := runtime.NumCPU()
 	wg.Add(workers)
-	urlCh := make(chan string)
+	rpmCh := make(chan *RPM)
 	errorCh := make(chan error)
 
 	// download worker
 	dlWorker := func() {
-		for url := range urlCh {
-			base := filepath.Base(url)
-			outFile := filepath.Join(outPath, base)
-			var dlErr error
-			// do not download again if it already exists
-			if _, dlErr = os.Stat(outFile); dlErr != nil {
-				dlErr = helpers.Download(url, outFile, false)
-			}
-			if dlErr != nil {
+		for r := range rpmCh {
+			url := fmt.Sprintf("%s/%s", repo.URI, r.Location)
+			outFile := filepath.Join(outPath, filepath.Base(r.Location))
+			if dlErr := downloadVerifiedRPM(url, outFile, r); dlErr != nil {
 				// report the error to the user
 				errorCh <- dlErr
 			}
@@ -224,13 +177,13 @@ func downloadAllRPMs(packages []string, workingDir string) error {
 		go dlWorker()
 	}
 
-	// populate the url channel
-	for _, url := range packages {
-		urlCh <- url
+	// populate the rpm channel
+	for _, r := range rpms {
+		rpmCh <- r
 	}
-	close(urlCh)
+	close(rpmCh)
 	wg.Wait()
-	// close this when all the urls have finished processing
+	// close this when all the rpms have finished processing
 	close(errorCh)
 
 	// final check for error that could happen after all workers are spawned
@@ -243,11 +196,7 @@ func downloadAllRPMs(packages []string, workingDir string) error {
 	return nil
 }
 
-// DownloadRepoFiles downloads all RPM packages from the RPM repo at the given
-// baseURL by first parsing the repo metadata. These packages are downloaded to
-// the c.CacheLocation/rpms/<version>/packages/ if they do not already exist
-// there.
-func DownloadRepoFiles(repo *Repo, update bool) (string, error) {
+func getWorkingDir(repo *Repo) (string, error) {
 	var err error
 	c, err = config.ReadConfig("")
 	if err != nil {
@@ -262,28 +211,63 @@ func DownloadRepoFiles(repo *Repo, update bool) (string, error) {
 		repo.Type,
 	)
 
-	if err = os.MkdirAll(workingDir, 0755); err != nil {
+	return workingDir, os.MkdirAll(workingDir, 0755)
+}
+
+// DownloadRepoMetadata downloads the repomd.xml of the RPM repo at repo.URI
+// along with the primary and filelists metadata it references. These are
+// downloaded to c.CacheLocation/rpms/<name>/<version>/<type>/ as repomd.xml,
+// primary.xml and filelists.xml. Returns the directory the metadata was
+// downloaded to.
+func DownloadRepoMetadata(repo *Repo, update bool) (string, error) {
+	workingDir, err := getWorkingDir(repo)
+	if err != nil {
 		return "", err
 	}
 
-	url, err := buildFilelistsURL(repo, workingDir, update)
+	urls, err := metadataURLs(repo, workingDir, update)
 	if err != nil {
 		return "", err
 	}
 
-	flistsPath := filepath.Join(workingDir, "filelists.xml")
-	// this file can be either gz or xz compressed, use DownloadFile
-	// which will use whatever extraction method is appropriate based
-	// on the file extension.
-	err = helpers.DownloadFile(url, flistsPath, update)
+	for _, key := range []string{"primary", "filelists"} {
+		url, ok := urls[key]
+		if !ok {
+			return "", fmt.Errorf("no %s metadata listed in %s repomd.xml", key, repo.URI)
+		}
+
+		out := filepath.Join(workingDir, key+".xml")
+		if _, err = os.Stat(out); err == nil && !update {
+			continue
+		}
+		// this file can be either gz or xz compressed, use DownloadFile
+		// which will use whatever extraction method is appropriate based
+		// on the file extension.
+		if err = helpers.DownloadFile(url, out, update); err != nil {
+			return "", err
+		}
+	}
+
+	return workingDir, nil
+}
+
+// DownloadRepoFiles downloads all RPM packages from the RPM repo at the given
+// baseURL by first parsing the repo metadata. These packages are downloaded to
+// the c.CacheLocation/rpms/<name>/<version>/<type>/packages/ unless a copy
+// matching the repo metadata checksum already exists there. Only checks that
+// need RPM payloads should call this, the repo metadata alone is enough to
+// import package information.
+func DownloadRepoFiles(repo *Repo, update bool) (string, error) {
+	workingDir, err := DownloadRepoMetadata(repo, update)
 	if err != nil {
 		return "", err
 	}
 
-	packages, err := buildPackageURLs(repo, flistsPath, workingDir, update)
+	primaryPath := filepath.Join(workingDir, "primary.xml")
+	rpms, err := listPackages(primaryPath, workingDir, update)
 	if err != nil {
 		return "", err
 	}
 
-	return filepath.Join(workingDir, "packages"), downloadAllRPMs(packages, workingDir)
+	return filepath.Join(workingDir, "packages"), downloadAllRPMs(repo, rpms, workingDir)
 }
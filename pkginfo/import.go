@@ -17,57 +17,62 @@ package pkginfo
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/cavaliercoder/go-rpm"
-	"github.com/gomodule/redigo/redis"
 )
 
 // ImportAllRPMs imports all RPMs from a given repository. It populates the
-// passed repo with all RPMs imported.
-func ImportAllRPMs(repo *Repo, update bool, path string) error {
-	var err error
-
-	if err = loadRepoFromCache(repo, path); err != nil {
+// passed repo with all RPMs imported. The payloads of binary RPMs are extracted
+// with rpm2cpio to compute the swupd hash of every file.
+func ImportAllRPMs(db Store, repo *Repo, update bool, path string) error {
+	if err := loadRepoFromCache(repo, path); err != nil {
 		return err
 	}
 
-	var c redis.Conn
-	if c, err = initRedis(0); err != nil {
-		return err
-	}
-	defer func() {
-		_ = c.Close()
-	}()
-	if err = storeRepoInfoRedis(c, repo); err != nil {
+	return db.StoreRepo(repo)
+}
+
+// ImportRepoMetadata imports package information for all RPMs listed in the
+// repo metadata downloaded to path by DownloadRepoMetadata. No RPM payloads are
+// needed, but File entries only carry the file name and type.
+func ImportRepoMetadata(db Store, repo *Repo, path string) error {
+	err := loadRepoFromMetadata(
+		repo,
+		filepath.Join(path, "primary.xml"),
+		filepath.Join(path, "filelists.xml"),
+	)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return db.StoreRepo(repo)
 }
 
-// ImportRPM imports a single RPM named <rpm> from a given repo. It adds the
+// ImportRPM imports a single RPM named <name> from a given repo. It adds the
 // RPM to the passed repo and returns the RPM struct.
-func ImportRPM(repo *Repo, rpm, path string, update bool) (*RPM, error) {
-	var err error
-
-	if err = loadRepoFromCache(repo, path); err != nil {
+func ImportRPM(db Store, repo *Repo, name, path string, update bool) (*RPM, error) {
+	pkgs, err := rpm.OpenPackageFiles(path)
+	if err != nil {
 		return nil, err
 	}
 
-	var c redis.Conn
-	if c, err = initRedis(0); err != nil {
-		return nil, err
-	}
-	defer func() {
-		_ = c.Close()
-	}()
-	for _, r := range repo.Packages {
-		if r.Name == rpm {
-			return r, storeRPMInfoRedis(c, repo, r)
+	// only the payload of the requested package is extracted for hashing
+	for i := range pkgs {
+		if pkgs[i].Name() != name {
+			continue
+		}
+		r, err := loadRPMFromPackage(pkgs[i])
+		if err != nil {
+			return nil, err
 		}
+		repo.Packages = appendUniqueRPMName(repo.Packages, r)
+		return r, db.StoreRPM(repo, r)
 	}
 
-	return nil, fmt.Errorf("unable to find %s RPM in %s repo", rpm, repo.Name)
+	return nil, fmt.Errorf("unable to find %s RPM in %s repo", name, repo.Name)
 }
 
 func fileFromPackageFile(pkgFI *rpm.FileInfo) *File {
@@ -89,7 +94,7 @@ func fileFromPackageFile(pkgFI *rpm.FileInfo) *File {
 		Type:           t,
 		Size:           uint(pkgFI.Size()),
 		Hash:           pkgFI.Digest(),
-		SwupdHash:      "", // TODO
+		SwupdHash:      "", // set from the payload by addSwupdHashes
 		Permissions:    pkgFI.Mode().Perm().String(),
 		Owner:          pkgFI.Owner(),
 		Group:          pkgFI.Group(),
@@ -98,24 +103,91 @@ func fileFromPackageFile(pkgFI *rpm.FileInfo) *File {
 	}
 }
 
+// srpmNameFromFile returns the package name of the source RPM file name
+// <name>-<version>-<release>.src.rpm
+func srpmNameFromFile(file string) string {
+	nvr := strings.TrimSuffix(file, ".src.rpm")
+	for i := 0; i < 2; i++ {
+		idx := strings.LastIndex(nvr, "-")
+		if idx < 0 {
+			return nvr
+		}
+		nvr = nvr[:idx]
+	}
+	return nvr
+}
+
+// flagsFromPackage converts the comparison bits of a dependency read from an
+// RPM header to the flags used in repo metadata
+func flagsFromPackage(flags int) string {
+	switch flags & (rpm.DepFlagLesser | rpm.DepFlagGreater | rpm.DepFlagEqual) {
+	case rpm.DepFlagEqual:
+		return FlagEQ
+	case rpm.DepFlagLesser:
+		return FlagLT
+	case rpm.DepFlagLesserOrEqual:
+		return FlagLE
+	case rpm.DepFlagGreater:
+		return FlagGT
+	case rpm.DepFlagGreaterOrEqual:
+		return FlagGE
+	}
+	return ""
+}
+
+func dependenciesFromPackage(deps []rpm.Dependency) []Dependency {
+	var ds []Dependency
+	for _, d := range deps {
+		dep := Dependency{
+			Name:  d.Name(),
+			Flags: flagsFromPackage(d.Flags()),
+		}
+		if dep.Flags != "" {
+			dep.EVR = EVR{
+				Epoch:   strconv.Itoa(d.Epoch()),
+				Version: d.Version(),
+				Release: d.Release(),
+			}
+		}
+		ds = append(ds, dep)
+	}
+	return ds
+}
+
 func rpmFromPackage(pkg *rpm.PackageFile) *RPM {
 	rpm := &RPM{
-		Name:         pkg.Name(),
-		Version:      pkg.Version(),
-		Release:      pkg.Release(),
-		Architecture: pkg.Architecture(),
-		SRPMName:     pkg.SourceRPM(),
-		License:      pkg.License(),
+		Name:          pkg.Name(),
+		Epoch:         pkg.Epoch(),
+		Version:       pkg.Version(),
+		Release:       pkg.Release(),
+		Architecture:  pkg.Architecture(),
+		License:       pkg.License(),
+		Conflicts:     dependenciesFromPackage(pkg.Conflicts()),
+		Obsoletes:     dependenciesFromPackage(pkg.Obsoletes()),
+		PackageSize:   uint(pkg.FileSize()),
+		InstalledSize: uint(pkg.Size()),
+		ArchiveSize:   uint(pkg.ArchiveSize()),
+		Location:      filepath.Join("Packages", filepath.Base(pkg.Path())),
 	}
 
-	for _, d := range pkg.Requires() {
-		rpm.Requires = append(rpm.Requires, d.Name())
+	// an unreadable package would have failed to open, so an error here is
+	// unexpected and the checksum is simply left empty
+	if sum, err := pkg.Checksum(); err == nil {
+		rpm.Checksum = sum
+		rpm.ChecksumType = pkg.ChecksumType()
 	}
 
-	for _, p := range pkg.Provides() {
-		rpm.Provides = append(rpm.Provides, p.Name())
+	// source RPMs have no source RPM of their own and list their build
+	// requirements as Requires
+	if pkg.SourceRPM() == "" {
+		rpm.BuildRequires = dependenciesFromPackage(pkg.Requires())
+	} else {
+		rpm.SRPMName = srpmNameFromFile(pkg.SourceRPM())
+		rpm.Requires = dependenciesFromPackage(pkg.Requires())
 	}
 
+	rpm.Provides = dependenciesFromPackage(pkg.Provides())
+
 	for _, f := range pkg.Files() {
 		rpm.Files = append(rpm.Files, fileFromPackageFile(&f))
 	}
@@ -133,6 +205,19 @@ func appendUniqueRPMName(rpms []*RPM, rpm *RPM) []*RPM {
 	return append(rpms, rpm)
 }
 
+// loadRPMFromPackage converts pkg to an RPM and, for binary RPMs, extracts the
+// payload to set the swupd hash of each file
+func loadRPMFromPackage(pkg *rpm.PackageFile) (*RPM, error) {
+	r := rpmFromPackage(pkg)
+	// source RPM payloads are sources and specs, which swupd never installs
+	if r.SRPMName != "" {
+		if err := addSwupdHashes(r, pkg.Path()); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
 func loadRepoFromCache(repo *Repo, cacheLoc string) error {
 	rpms, err := rpm.OpenPackageFiles(cacheLoc)
 	if err != nil {
@@ -140,7 +225,11 @@ func loadRepoFromCache(repo *Repo, cacheLoc string) error {
 	}
 
 	for i := range rpms {
-		repo.Packages = appendUniqueRPMName(repo.Packages, rpmFromPackage(rpms[i]))
+		r, err := loadRPMFromPackage(rpms[i])
+		if err != nil {
+			return err
+		}
+		repo.Packages = appendUniqueRPMName(repo.Packages, r)
 	}
 
 	return nil
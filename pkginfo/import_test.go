@@ -46,3 +46,18 @@ func TestAppendUniqueRPMName(t *testing.T) {
 		}
 	}
 }
+
+func TestSRPMNameFromFile(t *testing.T) {
+	tests := map[string]string{
+		"bash-4.4.23-56.src.rpm":         "bash",
+		"python-six-1.11.0-42.src.rpm":   "python-six",
+		"R-data.table-1.11.4-17.src.rpm": "R-data.table",
+		"noversion.src.rpm":              "noversion",
+	}
+
+	for file, exp := range tests {
+		if name := srpmNameFromFile(file); name != exp {
+			t.Errorf("expected %s from %s but got %s", exp, file, name)
+		}
+	}
+}
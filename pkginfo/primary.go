@@ -0,0 +1,270 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"strconv"
+)
+
+// <metadata xmlns="http://linux.duke.edu/metadata/common" xmlns:rpm="..." packages="7436">
+//   <package type="rpm">
+//     <name>pkgname</name>
+//     <arch>x86_64</arch>
+//     <version epoch="0" ver="ver" rel="rel"/>
+//     <checksum type="sha256" pkgid="YES">hash</checksum>
+//     <size package="1" installed="2" archive="3"/>
+//     <location href="Packages/pkgname-ver-rel.x86_64.rpm"/>
+//     <format>
+//       <rpm:license>license</rpm:license>
+//       <rpm:sourcerpm>pkgname-ver-rel.src.rpm</rpm:sourcerpm>
+//       <rpm:provides>
+//         <rpm:entry name="pkgname" flags="EQ" epoch="0" ver="ver" rel="rel"/>
+//       </rpm:provides>
+//       <rpm:requires>...</rpm:requires>
+//       <rpm:conflicts>...</rpm:conflicts>
+//       <rpm:obsoletes>...</rpm:obsoletes>
+//     </format>
+//   </package>
+//   ...
+// </metadata>
+//
+// encoding/xml matches the rpm: namespaced elements by their local names.
+
+// primaryEntry is a single dependency entry in the primary metadata
+type primaryEntry struct {
+	Name    string `xml:"name,attr"`
+	Flags   string `xml:"flags,attr"`
+	Epoch   string `xml:"epoch,attr"`
+	Version string `xml:"ver,attr"`
+	Release string `xml:"rel,attr"`
+	Pre     string `xml:"pre,attr"`
+}
+
+type primaryVersion struct {
+	Epoch   string `xml:"epoch,attr"`
+	Version string `xml:"ver,attr"`
+	Release string `xml:"rel,attr"`
+}
+
+type primaryChecksum struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type primarySize struct {
+	Package   uint `xml:"package,attr"`
+	Installed uint `xml:"installed,attr"`
+	Archive   uint `xml:"archive,attr"`
+}
+
+type primaryLocation struct {
+	Href string `xml:"href,attr"`
+}
+
+type primaryFormat struct {
+	License   string         `xml:"license"`
+	SourceRPM string         `xml:"sourcerpm"`
+	Provides  []primaryEntry `xml:"provides>entry"`
+	Requires  []primaryEntry `xml:"requires>entry"`
+	Conflicts []primaryEntry `xml:"conflicts>entry"`
+	Obsoletes []primaryEntry `xml:"obsoletes>entry"`
+}
+
+type primaryPackage struct {
+	Name     string          `xml:"name"`
+	Arch     string          `xml:"arch"`
+	Version  primaryVersion  `xml:"version"`
+	Checksum primaryChecksum `xml:"checksum"`
+	Size     primarySize     `xml:"size"`
+	Location primaryLocation `xml:"location"`
+	Format   primaryFormat   `xml:"format"`
+}
+
+// <filelists xmlns="http://linux.duke.edu/metadata/filelists" packages="7436">
+//   <package pkgid="hash" name="pkgname" arch="x86_64">
+//     <version epoch="0" ver="ver" rel="rel"/>
+//     <file>/usr/bin/file</file>
+//     <file type="dir">/usr/share/dir</file>
+//     ...
+//   </package>
+// </filelists>
+
+// filelistsFile is a single file listed for a package in the filelists
+// metadata
+type filelistsFile struct {
+	Type string `xml:"type,attr"`
+	Name string `xml:",chardata"`
+}
+
+type filelistsPackage struct {
+	PkgID string          `xml:"pkgid,attr"`
+	Name  string          `xml:"name,attr"`
+	Files []filelistsFile `xml:"file"`
+}
+
+// decodeEach streams the XML document in r and decodes every element named
+// elem into a new value from newV, calling fn with the result. This keeps
+// memory use bounded for the large repo metadata files.
+func decodeEach(r io.Reader, elem string, newV func() interface{}, fn func(interface{}) error) error {
+	d := xml.NewDecoder(r)
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		se, ok := t.(xml.StartElement)
+		if !ok || se.Name.Local != elem {
+			continue
+		}
+
+		v := newV()
+		if err = d.DecodeElement(v, &se); err != nil {
+			return err
+		}
+		if err = fn(v); err != nil {
+			return err
+		}
+	}
+}
+
+func dependenciesFromPrimary(entries []primaryEntry) []Dependency {
+	var deps []Dependency
+	for _, e := range entries {
+		deps = append(deps, Dependency{
+			Name:  e.Name,
+			Flags: e.Flags,
+			EVR:   EVR{Epoch: e.Epoch, Version: e.Version, Release: e.Release},
+		})
+	}
+	return deps
+}
+
+func rpmFromPrimary(p *primaryPackage) *RPM {
+	epoch, _ := strconv.Atoi(p.Version.Epoch)
+	rpm := &RPM{
+		Name:          p.Name,
+		Epoch:         epoch,
+		Version:       p.Version.Version,
+		Release:       p.Version.Release,
+		Architecture:  p.Arch,
+		License:       p.Format.License,
+		Conflicts:     dependenciesFromPrimary(p.Format.Conflicts),
+		Obsoletes:     dependenciesFromPrimary(p.Format.Obsoletes),
+		PackageSize:   p.Size.Package,
+		InstalledSize: p.Size.Installed,
+		ArchiveSize:   p.Size.Archive,
+		Checksum:      p.Checksum.Value,
+		ChecksumType:  p.Checksum.Type,
+		Location:      p.Location.Href,
+		Provides:      dependenciesFromPrimary(p.Format.Provides),
+	}
+
+	// source RPMs have no source RPM of their own and list their build
+	// requirements as requires
+	if p.Format.SourceRPM == "" {
+		rpm.BuildRequires = dependenciesFromPrimary(p.Format.Requires)
+	} else {
+		rpm.SRPMName = srpmNameFromFile(p.Format.SourceRPM)
+		rpm.Requires = dependenciesFromPrimary(p.Format.Requires)
+	}
+
+	return rpm
+}
+
+// parsePrimary parses the primary metadata at primaryPath and returns an RPM
+// for each package listed, keyed by its pkgid checksum.
+func parsePrimary(primaryPath string) (map[string]*RPM, []*RPM, error) {
+	f, err := os.Open(primaryPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	byID := make(map[string]*RPM)
+	var rpms []*RPM
+	err = decodeEach(f, "package",
+		func() interface{} { return &primaryPackage{} },
+		func(v interface{}) error {
+			r := rpmFromPrimary(v.(*primaryPackage))
+			byID[r.Checksum] = r
+			rpms = append(rpms, r)
+			return nil
+		})
+	return byID, rpms, err
+}
+
+// addFilelists adds the files listed in the filelists metadata at
+// filelistsPath to the RPMs they belong to. The filelists metadata only
+// carries file names and whether they are directories, so none of the content
+// or ownership information is populated. Ghost files are not installed by the
+// package and are skipped.
+func addFilelists(filelistsPath string, byID map[string]*RPM) error {
+	f, err := os.Open(filelistsPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	return decodeEach(f, "package",
+		func() interface{} { return &filelistsPackage{} },
+		func(v interface{}) error {
+			p := v.(*filelistsPackage)
+			r, ok := byID[p.PkgID]
+			if !ok {
+				return nil
+			}
+			for _, fl := range p.Files {
+				t := byte('F')
+				switch fl.Type {
+				case "ghost":
+					continue
+				case "dir":
+					t = byte('D')
+				}
+				r.Files = append(r.Files, &File{Name: fl.Name, Type: t})
+			}
+			return nil
+		})
+}
+
+// loadRepoFromMetadata populates repo.Packages from the primary and filelists
+// metadata without reading any RPM payloads
+func loadRepoFromMetadata(repo *Repo, primaryPath, filelistsPath string) error {
+	byID, rpms, err := parsePrimary(primaryPath)
+	if err != nil {
+		return err
+	}
+
+	if err = addFilelists(filelistsPath, byID); err != nil {
+		return err
+	}
+
+	for i := range rpms {
+		repo.Packages = appendUniqueRPMName(repo.Packages, rpms[i])
+	}
+
+	return nil
+}
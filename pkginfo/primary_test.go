@@ -0,0 +1,184 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testPrimary = `<?xml version="1.0" encoding="UTF-8"?>
+<metadata xmlns="http://linux.duke.edu/metadata/common" xmlns:rpm="http://linux.duke.edu/metadata/rpm" packages="2">
+<package type="rpm">
+  <name>bash</name>
+  <arch>x86_64</arch>
+  <version epoch="0" ver="4.4.23" rel="56"/>
+  <checksum type="sha256" pkgid="YES">aaaa</checksum>
+  <summary>bash</summary>
+  <size package="100" installed="200" archive="300"/>
+  <location href="Packages/bash-4.4.23-56.x86_64.rpm"/>
+  <format>
+    <rpm:license>GPL-3.0</rpm:license>
+    <rpm:sourcerpm>bash-4.4.23-56.src.rpm</rpm:sourcerpm>
+    <rpm:provides>
+      <rpm:entry name="bash" flags="EQ" epoch="0" ver="4.4.23" rel="56"/>
+      <rpm:entry name="/bin/sh"/>
+    </rpm:provides>
+    <rpm:requires>
+      <rpm:entry name="libc.so.6()(64bit)"/>
+      <rpm:entry name="ncurses" flags="GE" epoch="0" ver="6.0"/>
+    </rpm:requires>
+    <rpm:conflicts>
+      <rpm:entry name="dash"/>
+    </rpm:conflicts>
+    <rpm:obsoletes>
+      <rpm:entry name="bash-old" flags="LT" epoch="0" ver="4.0"/>
+    </rpm:obsoletes>
+    <file>/usr/bin/bash</file>
+  </format>
+</package>
+<package type="rpm">
+  <name>bash</name>
+  <arch>src</arch>
+  <version epoch="1" ver="4.4.23" rel="56"/>
+  <checksum type="sha256" pkgid="YES">bbbb</checksum>
+  <size package="1000" installed="2000" archive="3000"/>
+  <location href="Packages/bash-4.4.23-56.src.rpm"/>
+  <format>
+    <rpm:license>GPL-3.0</rpm:license>
+    <rpm:sourcerpm/>
+    <rpm:requires>
+      <rpm:entry name="ncurses-dev"/>
+    </rpm:requires>
+  </format>
+</package>
+</metadata>
+`
+
+const testFilelists = `<?xml version="1.0" encoding="UTF-8"?>
+<filelists xmlns="http://linux.duke.edu/metadata/filelists" packages="1">
+<package pkgid="aaaa" name="bash" arch="x86_64">
+  <version epoch="0" ver="4.4.23" rel="56"/>
+  <file>/usr/bin/bash</file>
+  <file type="dir">/usr/share/bash</file>
+  <file type="ghost">/var/log/bash.log</file>
+</package>
+<package pkgid="cccc" name="unknown" arch="x86_64">
+  <file>/usr/bin/unknown</file>
+</package>
+</filelists>
+`
+
+func writeTestMetadata(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "pkginfo-metadata-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "primary.xml"), []byte(testPrimary), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "filelists.xml"), []byte(testFilelists), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestParsePrimary(t *testing.T) {
+	dir := writeTestMetadata(t)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	byID, rpms, err := parsePrimary(filepath.Join(dir, "primary.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rpms) != 2 || len(byID) != 2 {
+		t.Fatalf("expected 2 RPMs but got %d", len(rpms))
+	}
+
+	bin := byID["aaaa"]
+	if bin.Name != "bash" || bin.Version != "4.4.23" || bin.Release != "56" ||
+		bin.Architecture != "x86_64" || bin.License != "GPL-3.0" {
+		t.Errorf("unexpected binary RPM metadata %+v", bin)
+	}
+	if bin.SRPMName != "bash" {
+		t.Errorf("expected SRPMName bash but got %s", bin.SRPMName)
+	}
+	if bin.PackageSize != 100 || bin.InstalledSize != 200 || bin.ArchiveSize != 300 {
+		t.Errorf("unexpected sizes %d %d %d", bin.PackageSize, bin.InstalledSize, bin.ArchiveSize)
+	}
+	if bin.Checksum != "aaaa" || bin.ChecksumType != "sha256" {
+		t.Errorf("unexpected checksum %s:%s", bin.ChecksumType, bin.Checksum)
+	}
+	if bin.Location != "Packages/bash-4.4.23-56.x86_64.rpm" {
+		t.Errorf("unexpected location %s", bin.Location)
+	}
+	if !sameStrings(depStrings(bin.Requires), []string{"libc.so.6()(64bit)", "ncurses >= 6.0"}) {
+		t.Errorf("unexpected requires %v", bin.Requires)
+	}
+	if !sameStrings(depStrings(bin.Provides), []string{"bash = 4.4.23-56", "/bin/sh"}) {
+		t.Errorf("unexpected provides %v", bin.Provides)
+	}
+	if !sameStrings(depStrings(bin.Conflicts), []string{"dash"}) ||
+		!sameStrings(depStrings(bin.Obsoletes), []string{"bash-old < 4.0"}) {
+		t.Errorf("unexpected conflicts %v or obsoletes %v", bin.Conflicts, bin.Obsoletes)
+	}
+	if len(bin.BuildRequires) != 0 {
+		t.Errorf("binary RPM should not have build requires but got %v", bin.BuildRequires)
+	}
+
+	src := byID["bbbb"]
+	if src.SRPMName != "" || src.Epoch != 1 {
+		t.Errorf("unexpected source RPM metadata %+v", src)
+	}
+	if !sameStrings(depStrings(src.BuildRequires), []string{"ncurses-dev"}) || len(src.Requires) != 0 {
+		t.Errorf("expected build requires [ncurses-dev] but got %v (requires %v)",
+			src.BuildRequires, src.Requires)
+	}
+}
+
+func TestLoadRepoFromMetadata(t *testing.T) {
+	dir := writeTestMetadata(t)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	repo := &Repo{}
+	err := loadRepoFromMetadata(repo,
+		filepath.Join(dir, "primary.xml"), filepath.Join(dir, "filelists.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// both RPMs are named bash, only the first is kept
+	if len(repo.Packages) != 1 {
+		t.Fatalf("expected 1 package but got %d", len(repo.Packages))
+	}
+
+	files := repo.Packages[0].Files
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files but got %d", len(files))
+	}
+	if files[0].Name != "/usr/bin/bash" || files[0].Type != 'F' {
+		t.Errorf("unexpected file %+v", files[0])
+	}
+	if files[1].Name != "/usr/share/bash" || files[1].Type != 'D' {
+		t.Errorf("unexpected file %+v", files[1])
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"sort"
+	"strings"
+)
+
+// Reverse lookup indexes kept by every Store. Each maps an item, a file path
+// or capability name, to the names of the RPMs that own, provide or require
+// it.
+const (
+	ownersIndex   = "owners"
+	providesIndex = "provides"
+	requiresIndex = "requires"
+)
+
+// reverseIndexItems returns the items rpm is listed under in each reverse
+// index. Build requirements of source RPMs are indexed as requirements so
+// reverse lookups work the same way in source repos.
+func reverseIndexItems(rpm *RPM) map[string][]string {
+	items := make(map[string][]string)
+	for _, f := range rpm.Files {
+		items[ownersIndex] = append(items[ownersIndex], f.Name)
+	}
+	items[providesIndex] = dependencyNames(rpm.Provides)
+	items[requiresIndex] = append(dependencyNames(rpm.Requires), dependencyNames(rpm.BuildRequires)...)
+	return items
+}
+
+// uniqueSorted sorts names and removes duplicates
+func uniqueSorted(names []string) []string {
+	sort.Strings(names)
+	var res []string
+	for i, n := range names {
+		if i == 0 || n != names[i-1] {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// WhatOwns returns the names of the RPMs in repo that ship a file at path
+func WhatOwns(db Store, repo *Repo, path string) ([]string, error) {
+	return db.FileOwners(repo, path)
+}
+
+// WhatProvides returns the names of the RPMs in repo that provide capability.
+// A capability that is an absolute path is also provided by the RPMs that ship
+// a file at that path.
+func WhatProvides(db Store, repo *Repo, capability string) ([]string, error) {
+	providers, err := db.Providers(repo, capability)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(capability, "/") {
+		owners, err := db.FileOwners(repo, capability)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, owners...)
+	}
+
+	return uniqueSorted(providers), nil
+}
+
+// WhatRequires returns the names of the RPMs in repo with a requirement that
+// the RPM named rpm satisfies, through either its versioned provides or the
+// files it ships. Other RPMs that could satisfy the same requirements are not
+// taken into account.
+func WhatRequires(db Store, repo *Repo, rpm string) ([]string, error) {
+	r, err := GetRPM(db, repo, rpm)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]bool)
+	caps := dependencyNames(r.Provides)
+	for _, f := range r.Files {
+		files[f.Name] = true
+		caps = append(caps, f.Name)
+	}
+
+	var candidates []string
+	for _, c := range uniqueSorted(caps) {
+		requirers, err := db.Requirers(repo, c)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, requirers...)
+	}
+
+	var res []string
+	for _, name := range uniqueSorted(candidates) {
+		if name == r.Name {
+			continue
+		}
+
+		c, err := GetRPM(db, repo, name)
+		if err != nil {
+			return nil, err
+		}
+		if requiresAny(c, r, files) {
+			res = append(res, name)
+		}
+	}
+
+	return res, nil
+}
+
+// requiresAny reports whether c has a requirement satisfied by the provides of
+// r or by one of the files r ships
+func requiresAny(c, r *RPM, files map[string]bool) bool {
+	for _, deps := range [][]Dependency{c.Requires, c.BuildRequires} {
+		for _, req := range deps {
+			if files[req.Name] || r.Satisfies(req) {
+				return true
+			}
+		}
+	}
+	return false
+}
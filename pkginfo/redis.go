@@ -15,22 +15,297 @@
 package pkginfo
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/clearlinux/diva/internal/config"
 	"github.com/gomodule/redigo/redis"
 )
 
-// initRedis checks whether a redis-server is running and initializes it if
-// needed.
-// TODO: actually start the redis server if not running, right now it just
-// returns an error if there isn't one running.
-func initRedis(port int) (redis.Conn, error) {
-	p := ":6379"
-	if port != 0 {
-		p = fmt.Sprintf(":%d", port)
+const defaultRedisAddress = "localhost:6379"
+
+// redisServer is the private redis-server in the cache location, which is
+// shared by every diva process using that cache. Each process holds a shared
+// lock on the users file for as long as it uses the server, so the last one to
+// release the server knows no other process needs it any more and shuts it
+// down. Starting and shutting down the server happen under the exclusive start
+// lock, so a process never connects to a server that is about to go away.
+type redisServer struct {
+	sock  string
+	opts  []redis.DialOption
+	users *os.File
+	// cmd and done are only set in the process that started the server
+	cmd  *exec.Cmd
+	done chan error
+}
+
+// lockFile opens the file at path, creating it if needed, and locks it with
+// flock operation how. The lock is held until the file is closed.
+func lockFile(path string, how int) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err = syscall.Flock(int(f.Fd()), how); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *redisServer) startLock() (*os.File, error) {
+	return lockFile(filepath.Join(filepath.Dir(s.sock), "start.lock"), syscall.LOCK_EX)
+}
+
+// stop shuts down a private redis-server started by this process, which saves
+// its data to the cache location before exiting.
+func (s *redisServer) stop() error {
+	if err := s.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		return err
+	}
+	return <-s.done
+}
+
+// release gives up the use of the server by this process. The last process
+// using the server shuts it down, which saves its data to the cache location.
+func (s *redisServer) release() error {
+	defer func() {
+		_ = s.users.Close()
+	}()
+
+	start, err := s.startLock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = start.Close()
+	}()
+
+	// another process still holds its shared lock and keeps the server
+	err = syscall.Flock(int(s.users.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.cmd != nil {
+		return s.stop()
+	}
+	conn, err := redis.Dial("unix", s.sock, s.opts...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	// the server drops the connection once it has saved its data, so only an
+	// error reply means the shutdown failed
+	if _, err = conn.Do("SHUTDOWN", "SAVE"); err != nil {
+		if _, ok := err.(redis.Error); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// redisDialOptions returns the options to connect to the redis-server
+// configured in c.Redis. The private redis-server has no password, it is only
+// reachable through a socket that only its user may open, so c.Redis.Password
+// is not used when c.Redis.Spawn is set.
+func redisDialOptions(c *config.Config) []redis.DialOption {
+	opts := []redis.DialOption{redis.DialDatabase(c.Redis.DB)}
+	if c.Redis.Password != "" && !c.Redis.Spawn {
+		opts = append(opts, redis.DialPassword(c.Redis.Password))
+	}
+	if c.Redis.Timeout > 0 {
+		t := time.Duration(c.Redis.Timeout) * time.Second
+		opts = append(opts,
+			redis.DialConnectTimeout(t),
+			redis.DialReadTimeout(t),
+			redis.DialWriteTimeout(t),
+		)
+	}
+	return opts
+}
+
+// spawn starts the private redis-server that only listens on the unix socket
+// s.sock and keeps its data next to it. The server runs in its own process
+// group and outlives this process, since other diva processes may be using it.
+func (s *redisServer) spawn() error {
+	dir := filepath.Dir(s.sock)
+	cmd := exec.Command("redis-server",
+		"--port", "0",
+		"--unixsocket", s.sock,
+		"--unixsocketperm", "700",
+		"--dir", dir,
+		"--dbfilename", "pkginfo.rdb",
+	)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	var errBuf bytes.Buffer
+	cmd.Stderr = &errBuf
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	s.cmd, s.done = cmd, make(chan error, 1)
+	go func() {
+		s.done <- cmd.Wait()
+	}()
+
+	// wait for the server to accept connections on the socket
+	for i := 0; i < 100; i++ {
+		select {
+		case err := <-s.done:
+			return fmt.Errorf("redis-server exited: %v %s", err, errBuf.String())
+		case <-time.After(100 * time.Millisecond):
+		}
+		if c, err := redis.Dial("unix", s.sock); err == nil {
+			_ = c.Close()
+			return nil
+		}
+	}
+
+	_ = s.stop()
+	return fmt.Errorf("timed out waiting for redis-server on %s", s.sock)
+}
+
+// connectPrivateRedis connects to the private redis-server listening on sock,
+// starting it first if no other diva process is running it. The returned
+// redisServer must be released once the connection is closed.
+func connectPrivateRedis(sock string, opts []redis.DialOption) (redis.Conn, *redisServer, error) {
+	if err := os.MkdirAll(filepath.Dir(sock), 0700); err != nil {
+		return nil, nil, err
+	}
+
+	s := &redisServer{sock: sock, opts: opts}
+	start, err := s.startLock()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = start.Close()
+	}()
+
+	s.users, err = lockFile(filepath.Join(filepath.Dir(sock), "users.lock"), syscall.LOCK_SH)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// another diva process may already be running the server
+	conn, err := redis.Dial("unix", sock, opts...)
+	if err == nil {
+		return conn, s, nil
+	}
+
+	if err = s.spawn(); err != nil {
+		_ = s.users.Close()
+		return nil, nil, err
+	}
+	conn, err = redis.Dial("unix", sock, opts...)
+	if err != nil {
+		_ = s.stop()
+		_ = s.users.Close()
+		return nil, nil, err
+	}
+	return conn, s, nil
+}
+
+// initRedis connects to the redis-server configured in c.Redis. If c.Redis.Spawn
+// is set, connect to the private redis-server in the cache location, starting
+// it first if it is not already running. The private server is returned so
+// the caller can release it when done.
+func initRedis(c *config.Config) (redis.Conn, *redisServer, error) {
+	opts := redisDialOptions(c)
+	if c.Redis.Spawn {
+		sock := filepath.Join(c.Paths.CacheLocation, "redis", "redis.sock")
+		return connectPrivateRedis(sock, opts)
 	}
-	return redis.Dial("tcp", p)
+
+	if c.Redis.Socket != "" {
+		conn, err := redis.Dial("unix", c.Redis.Socket, opts...)
+		return conn, nil, err
+	}
+
+	addr := c.Redis.Address
+	if addr == "" {
+		addr = defaultRedisAddress
+	}
+	conn, err := redis.Dial("tcp", addr, opts...)
+	return conn, nil, err
+}
+
+// redisStore is the Store backed by a running redis-server
+type redisStore struct {
+	c      redis.Conn
+	server *redisServer
+}
+
+func newRedisStore(c *config.Config) (*redisStore, error) {
+	conn, server, err := initRedis(c)
+	if err != nil {
+		return nil, err
+	}
+	return &redisStore{c: conn, server: server}, nil
+}
+
+// StoreRepo stores all data in repo to the running redis-server
+func (s *redisStore) StoreRepo(repo *Repo) error {
+	return storeRepoInfoRedis(s.c, repo)
+}
+
+// StoreRPM stores the rpm under the constructed repo key in the running
+// redis-server
+func (s *redisStore) StoreRPM(repo *Repo, rpm *RPM) error {
+	return storeRPMInfoRedis(s.c, repo, rpm)
+}
+
+// GetRepo retrieves all data associated with the given repo from the running
+// redis-server
+func (s *redisStore) GetRepo(repo *Repo) error {
+	return getRepoRedis(s.c, repo)
+}
+
+// GetRPM retrieves the named rpm in the repo from the running redis-server
+func (s *redisStore) GetRPM(repo *Repo, rpm string) (*RPM, error) {
+	return getRPMRedis(s.c, repo, rpm)
+}
+
+// FileOwners returns the names of the RPMs in the repo that ship path
+func (s *redisStore) FileOwners(repo *Repo, path string) ([]string, error) {
+	return lookupRedis(s.c, repo, ownersIndex, path)
+}
+
+// Providers returns the names of the RPMs in the repo that provide capability
+func (s *redisStore) Providers(repo *Repo, capability string) ([]string, error) {
+	return lookupRedis(s.c, repo, providesIndex, capability)
+}
+
+// Requirers returns the names of the RPMs in the repo that require capability
+func (s *redisStore) Requirers(repo *Repo, capability string) ([]string, error) {
+	return lookupRedis(s.c, repo, requiresIndex, capability)
+}
+
+// Close closes the connection to the redis-server and releases the private
+// redis-server, which stops it if no other diva process is using it
+func (s *redisStore) Close() error {
+	err := s.c.Close()
+	if s.server != nil {
+		if serr := s.server.release(); err == nil {
+			err = serr
+		}
+	}
+	return err
 }
 
 func storeIterableRedisSet(c redis.Conn, key string, value []string) error {
@@ -42,6 +317,112 @@ func storeIterableRedisSet(c redis.Conn, key string, value []string) error {
 	return c.Flush()
 }
 
+// encodeDependenciesRedis encodes deps as JSON so the full version constraint
+// of each dependency survives the round trip through a redis hash field
+func encodeDependenciesRedis(deps []Dependency) ([]byte, error) {
+	if deps == nil {
+		deps = []Dependency{}
+	}
+	return json.Marshal(deps)
+}
+
+// decodeDependenciesRedis decodes a dependency hash field. Older versions of
+// diva stored only the dependency names in "[a b c]" form, these are read back
+// as unversioned dependencies.
+func decodeDependenciesRedis(b []byte) []Dependency {
+	var deps []Dependency
+	if err := json.Unmarshal(b, &deps); err == nil {
+		return deps
+	}
+
+	deps = []Dependency{}
+	for _, name := range strings.Fields(strings.Trim(string(b), "[]")) {
+		deps = append(deps, Dependency{Name: name})
+	}
+	return deps
+}
+
+// redisIndexKey returns the key of the set holding the names of the packages
+// listed under item in the named reverse index of the repo. The '@' separator
+// keeps these apart from the per-package keys.
+func redisIndexKey(repoKey, index, item string) string {
+	return fmt.Sprintf("%s@%s:%s", repoKey, index, item)
+}
+
+// clearRPMRedis removes the reverse index entries, the requires and provides
+// sets, the file index and the fileN hash of every file of the previously
+// stored version of the named package, if there is one, so storing the new
+// version does not leave stale entries behind
+func clearRPMRedis(c redis.Conn, repoKey, name string) error {
+	pkgKey := fmt.Sprintf("%s:%s", repoKey, name)
+	exists, err := redis.Bool(c.Do("HEXISTS", pkgKey, "Name"))
+	if err != nil || !exists {
+		return err
+	}
+
+	old := &RPM{Name: name}
+	for field, deps := range map[string]*[]Dependency{
+		"Requires":      &old.Requires,
+		"BuildRequires": &old.BuildRequires,
+		"Provides":      &old.Provides,
+	} {
+		v, err := getOptionalRedis(c, pkgKey, field)
+		if err != nil {
+			return err
+		}
+		*deps = decodeDependenciesRedis([]byte(v))
+	}
+
+	// the files hash maps each file name to the fileN key of its attributes
+	files, err := redis.StringMap(c.Do("HGETALL", pkgKey+":files"))
+	if err != nil {
+		return err
+	}
+	keys := []string{":requires", ":provides", ":files"}
+	for f, fIdx := range files {
+		old.Files = append(old.Files, &File{Name: f})
+		keys = append(keys, ":"+fIdx)
+	}
+
+	for index, items := range reverseIndexItems(old) {
+		for _, item := range items {
+			if err = c.Send("SREM", redisIndexKey(repoKey, index, item), name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, key := range keys {
+		if err = c.Send("DEL", pkgKey+key); err != nil {
+			return err
+		}
+	}
+	return c.Flush()
+}
+
+// storeIndexesRedis adds the reverse index entries for rpm
+func storeIndexesRedis(c redis.Conn, repoKey string, rpm *RPM) error {
+	for index, items := range reverseIndexItems(rpm) {
+		for _, item := range items {
+			if err := c.Send("SADD", redisIndexKey(repoKey, index, item), rpm.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return c.Flush()
+}
+
+// lookupRedis returns the sorted package names listed under item in the named
+// reverse index of the repo
+func lookupRedis(c redis.Conn, repo *Repo, index, item string) ([]string, error) {
+	repoKey := fmt.Sprintf("%s%s%s", repo.Name, repo.Version, repo.Type)
+	names, err := redis.Strings(c.Do("SMEMBERS", redisIndexKey(repoKey, index, item)))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
 // storeRepoInfoRedis stores all data in repo to the running redis-server
 func storeRepoInfoRedis(c redis.Conn, repo *Repo) error {
 	repoKey := fmt.Sprintf("%s%s%s", repo.Name, repo.Version, repo.Type)
@@ -62,6 +443,9 @@ func storeRepoInfoRedis(c redis.Conn, repo *Repo) error {
 // running redis-server
 func storeRPMInfoRedis(c redis.Conn, repo *Repo, rpm *RPM) error {
 	repoKey := fmt.Sprintf("%s%s%s", repo.Name, repo.Version, repo.Type)
+	if err := clearRPMRedis(c, repoKey, rpm.Name); err != nil {
+		return err
+	}
 	if _, err := c.Do("SADD", repoKey+":packages", rpm.Name); err != nil {
 		return err
 	}
@@ -71,15 +455,36 @@ func storeRPMInfoRedis(c redis.Conn, repo *Repo, rpm *RPM) error {
 		return err
 	}
 
+	// AddFlat formats the dependency slices with fmt, which cannot be parsed
+	// back, so overwrite those fields with their JSON encoding
+	deps := map[string][]Dependency{
+		"Requires":      rpm.Requires,
+		"BuildRequires": rpm.BuildRequires,
+		"Provides":      rpm.Provides,
+		"Conflicts":     rpm.Conflicts,
+		"Obsoletes":     rpm.Obsoletes,
+	}
+	args := redis.Args{}.Add(pkgKey)
+	for field, d := range deps {
+		b, err := encodeDependenciesRedis(d)
+		if err != nil {
+			return err
+		}
+		args = args.Add(field, b)
+	}
+	if _, err = c.Do("HMSET", args...); err != nil {
+		return err
+	}
+
 	// store the requires
 	rKey := pkgKey + ":requires"
-	if err := storeIterableRedisSet(c, rKey, rpm.Requires); err != nil {
+	if err := storeIterableRedisSet(c, rKey, dependencyNames(rpm.Requires)); err != nil {
 		return err
 	}
 
 	// store the provides
 	pKey := pkgKey + ":provides"
-	if err := storeIterableRedisSet(c, pKey, rpm.Provides); err != nil {
+	if err := storeIterableRedisSet(c, pKey, dependencyNames(rpm.Provides)); err != nil {
 		return err
 	}
 
@@ -101,7 +506,8 @@ func storeRPMInfoRedis(c redis.Conn, repo *Repo, rpm *RPM) error {
 			return err
 		}
 	}
-	return nil
+
+	return storeIndexesRedis(c, repoKey, rpm)
 }
 
 func getFilesRedis(c redis.Conn, repo *Repo, p *RPM) ([]*File, error) {
@@ -131,6 +537,60 @@ func getFilesRedis(c redis.Conn, repo *Repo, p *RPM) ([]*File, error) {
 	return files, nil
 }
 
+// getOptionalRedis gets a hash field that older versions of diva did not
+// store. A missing field is returned as an empty string rather than an error so
+// previously imported repos can still be read.
+func getOptionalRedis(c redis.Conn, key, field string) (string, error) {
+	v, err := redis.String(c.Do("HGET", key, field))
+	if err == redis.ErrNil {
+		return "", nil
+	}
+	return v, err
+}
+
+// getMetadataRedis gets the RPM fields populated from repo metadata
+func getMetadataRedis(c redis.Conn, pkgKey string, p *RPM) error {
+	fields := make(map[string]string)
+	for _, f := range []string{
+		"Epoch", "Conflicts", "Obsoletes", "PackageSize", "InstalledSize",
+		"ArchiveSize", "Checksum", "ChecksumType", "Location",
+	} {
+		v, err := getOptionalRedis(c, pkgKey, f)
+		if err != nil {
+			return err
+		}
+		fields[f] = v
+	}
+
+	var err error
+	var size uint64
+	if fields["Epoch"] != "" {
+		if p.Epoch, err = strconv.Atoi(fields["Epoch"]); err != nil {
+			return err
+		}
+	}
+	for f, v := range map[string]*uint{
+		"PackageSize":   &p.PackageSize,
+		"InstalledSize": &p.InstalledSize,
+		"ArchiveSize":   &p.ArchiveSize,
+	} {
+		if fields[f] == "" {
+			continue
+		}
+		if size, err = strconv.ParseUint(fields[f], 10, 64); err != nil {
+			return err
+		}
+		*v = uint(size)
+	}
+
+	p.Conflicts = decodeDependenciesRedis([]byte(fields["Conflicts"]))
+	p.Obsoletes = decodeDependenciesRedis([]byte(fields["Obsoletes"]))
+	p.Checksum = fields["Checksum"]
+	p.ChecksumType = fields["ChecksumType"]
+	p.Location = fields["Location"]
+	return nil
+}
+
 func getRPMRedis(c redis.Conn, repo *Repo, rpmName string) (*RPM, error) {
 	var err error
 	p := &RPM{}
@@ -169,19 +629,23 @@ func getRPMRedis(c redis.Conn, repo *Repo, rpmName string) (*RPM, error) {
 	if err != nil {
 		return nil, err
 	}
-	p.Requires = strings.Fields(strings.Trim(string(rb), "[]"))
+	p.Requires = decodeDependenciesRedis(rb)
 
 	bb, err := redis.Bytes(c.Do("HGET", pkgKey, "BuildRequires"))
 	if err != nil {
 		return nil, err
 	}
-	p.BuildRequires = strings.Fields(strings.Trim(string(bb), "[]"))
+	p.BuildRequires = decodeDependenciesRedis(bb)
 
 	pb, err := redis.Bytes(c.Do("HGET", pkgKey, "Provides"))
 	if err != nil {
 		return nil, err
 	}
-	p.Provides = strings.Fields(strings.Trim(string(pb), "[]"))
+	p.Provides = decodeDependenciesRedis(pb)
+
+	if err = getMetadataRedis(c, pkgKey, p); err != nil {
+		return nil, err
+	}
 
 	p.Files, err = getFilesRedis(c, repo, p)
 	if err != nil {
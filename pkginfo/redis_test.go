@@ -16,8 +16,13 @@ package pkginfo
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
 
+	"github.com/clearlinux/diva/internal/config"
 	"github.com/rafaeljusto/redigomock"
 )
 
@@ -43,9 +48,21 @@ func TestGetRepoRedis(t *testing.T) {
 		conn.Command("HGET", pkgKey, "Architecture").Expect("xTEST"),
 		conn.Command("HGET", pkgKey, "SRPMName").Expect("testpkg.src.rpm"),
 		conn.Command("HGET", pkgKey, "License").Expect("license"),
-		conn.Command("HGET", pkgKey, "Requires").Expect([]byte("reqs")),
+		conn.Command("HGET", pkgKey, "Requires").Expect([]byte(
+			`[{"Name":"reqs","Flags":"GE","EVR":{"Epoch":"0","Version":"2.0","Release":""}}]`)),
 		conn.Command("HGET", pkgKey, "BuildRequires").Expect([]byte("breqs")),
 		conn.Command("HGET", pkgKey, "Provides").Expect([]byte("provs")),
+		conn.Command("HGET", pkgKey, "Epoch").Expect([]byte("1")),
+		// dependencies stored by older versions are only names
+		conn.Command("HGET", pkgKey, "Conflicts").Expect([]byte("[conf]")),
+		conn.Command("HGET", pkgKey, "Obsoletes").Expect([]byte("[obs]")),
+		conn.Command("HGET", pkgKey, "PackageSize").Expect([]byte("10")),
+		conn.Command("HGET", pkgKey, "InstalledSize").Expect([]byte("20")),
+		conn.Command("HGET", pkgKey, "ArchiveSize").Expect([]byte("30")),
+		conn.Command("HGET", pkgKey, "Checksum").Expect([]byte("abc")),
+		conn.Command("HGET", pkgKey, "ChecksumType").Expect([]byte("sha256")),
+		// a missing field from an older import is not an error
+		conn.Command("HGET", pkgKey, "Location").Expect(nil),
 		// this effectively tests getFilesRedis as well
 		conn.Command("HVALS", fIdxKey).ExpectStringSlice([]string{"file1", "file2"}...),
 		conn.Command("HGETALL", fKey+"1").ExpectMap(map[string]string{"Name": "f1"}),
@@ -73,6 +90,18 @@ func TestGetRepoRedis(t *testing.T) {
 		t.Errorf("RPM was named '%s' but expected testpkg", p.Name)
 	}
 
+	if p.Epoch != 1 || p.InstalledSize != 20 || p.Checksum != "abc" || p.Location != "" {
+		t.Errorf("unexpected metadata fields %+v", p)
+	}
+
+	if len(p.Requires) != 1 || p.Requires[0].String() != "reqs >= 2.0" {
+		t.Errorf("expected requires [reqs >= 2.0] but got %v", p.Requires)
+	}
+
+	if len(p.Conflicts) != 1 || p.Conflicts[0].Name != "conf" || p.Conflicts[0].Flags != "" {
+		t.Errorf("expected conflicts [conf] but got %v", p.Conflicts)
+	}
+
 	if len(p.Files) != 2 {
 		// fatal since we access via indices below
 		t.Fatalf("expected 2 files but got %d", len(p.Files))
@@ -91,6 +120,7 @@ func TestStoreRPMInfoRedis(t *testing.T) {
 	conn := redigomock.NewConn()
 	cmds := []*redigomock.Cmd{
 		conn.GenericCommand("SET").Expect("ok"),
+		conn.GenericCommand("HEXISTS").Expect(int64(0)),
 		conn.GenericCommand("SADD").Expect("ok"),
 		conn.GenericCommand("HMSET").Expect("ok"),
 	}
@@ -103,7 +133,7 @@ func TestStoreRPMInfoRedis(t *testing.T) {
 				Name:     "testpkg",
 				Version:  "100",
 				Release:  "1",
-				Provides: []string{"one", "two"},
+				Provides: []Dependency{{Name: "one"}, {Name: "two"}},
 				Files: []*File{
 					{Name: "f1"},
 					{Name: "f2"},
@@ -122,3 +152,54 @@ func TestStoreRPMInfoRedis(t *testing.T) {
 		}
 	}
 }
+
+func TestReleaseSharedServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	usersPath := filepath.Join(dir, "users.lock")
+	newUser := func() *redisServer {
+		users, err := lockFile(usersPath, syscall.LOCK_SH)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &redisServer{sock: filepath.Join(dir, "redis.sock"), users: users}
+	}
+
+	first, second := newUser(), newUser()
+	// the second user still holds the server, so it must be left running
+	if err = first.release(); err != nil {
+		t.Errorf("expected the server to be kept for the other user but got %v", err)
+	}
+	// the last user shuts the server down, which is not listening here
+	if err = second.release(); err == nil {
+		t.Error("expected the last user to try to shut the server down")
+	}
+}
+
+func TestRedisDialOptions(t *testing.T) {
+	testCases := []struct {
+		name     string
+		spawn    bool
+		expected int
+	}{
+		{"server", false, 2},
+		{"private server", true, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &config.Config{}
+			c.Redis.Password = "secret"
+			c.Redis.Spawn = tc.spawn
+			if opts := redisDialOptions(c); len(opts) != tc.expected {
+				t.Errorf("expected %d options but got %d", tc.expected, len(opts))
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"sort"
+)
+
+// DroppedSRPM is a source RPM of the from repo of a comparison that no
+// binary RPM of the to repo is built from. Packages lists the binary RPMs built
+// from it that are gone from the to repo without being obsoleted, which dnf
+// leaves installed and stale on upgrade.
+type DroppedSRPM struct {
+	Name     string
+	Packages []string
+}
+
+// obsoleted reports whether any RPM in rpms obsoletes r
+func obsoleted(r *RPM, rpms []*RPM) bool {
+	self := Dependency{Name: r.Name, Flags: FlagEQ, EVR: r.EVR()}
+	for _, o := range rpms {
+		for _, obs := range o.Obsoletes {
+			if obs.Overlaps(self) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DroppedSRPMs returns the source RPMs of the binary RPMs in from that no
+// binary RPM in to is built from anymore, and whose binary RPMs are not all
+// still in to or obsoleted by an RPM in to, sorted by name.
+func DroppedSRPMs(from, to *Repo) []DroppedSRPM {
+	toSRPMs := make(map[string]bool)
+	toPkgs := make(map[string]bool)
+	for _, r := range to.Packages {
+		toSRPMs[r.SRPMName] = true
+		toPkgs[r.Name] = true
+	}
+
+	stale := make(map[string][]string)
+	for _, r := range from.Packages {
+		if r.SRPMName == "" || toSRPMs[r.SRPMName] {
+			continue
+		}
+		if toPkgs[r.Name] || obsoleted(r, to.Packages) {
+			continue
+		}
+		stale[r.SRPMName] = append(stale[r.SRPMName], r.Name)
+	}
+
+	var dropped []DroppedSRPM
+	for name, pkgs := range stale {
+		sort.Strings(pkgs)
+		dropped = append(dropped, DroppedSRPM{Name: name, Packages: pkgs})
+	}
+	sort.Slice(dropped, func(i, j int) bool {
+		return dropped[i].Name < dropped[j].Name
+	})
+	return dropped
+}
@@ -0,0 +1,51 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDroppedSRPMs(t *testing.T) {
+	from := &Repo{
+		Packages: []*RPM{
+			{Name: "kept", SRPMName: "kept"},
+			{Name: "orphan", SRPMName: "gone"},
+			{Name: "orphan-bin", SRPMName: "gone"},
+			{Name: "old", Version: "1.0", Release: "1", SRPMName: "replaced"},
+			{Name: "moved", SRPMName: "replaced"},
+			{Name: "tooold", Version: "3.0", Release: "1", SRPMName: "partial"},
+		},
+	}
+	to := &Repo{
+		Packages: []*RPM{
+			{Name: "kept", SRPMName: "kept"},
+			{Name: "moved", SRPMName: "other"},
+			{Name: "new", SRPMName: "other", Obsoletes: []Dependency{
+				{Name: "old", Flags: FlagLT, EVR: EVR{Version: "2.0"}},
+				{Name: "tooold", Flags: FlagLT, EVR: EVR{Version: "2.0"}},
+			}},
+		},
+	}
+
+	expected := []DroppedSRPM{
+		{Name: "gone", Packages: []string{"orphan", "orphan-bin"}},
+		{Name: "partial", Packages: []string{"tooold"}},
+	}
+	if dropped := DroppedSRPMs(from, to); !reflect.DeepEqual(dropped, expected) {
+		t.Errorf("expected %v but got %v", expected, dropped)
+	}
+}
@@ -16,21 +16,10 @@ package pkginfo
 
 import (
 	"path/filepath"
-
-	"github.com/gomodule/redigo/redis"
 )
 
 // PopulateRepo populates the repo struct with all RPMs from the database
-func PopulateRepo(repo *Repo, cacheLoc string) error {
-	var err error
-	var c redis.Conn
-	if c, err = initRedis(0); err != nil {
-		return err
-	}
-	defer func() {
-		_ = c.Close()
-	}()
-
+func PopulateRepo(db Store, repo *Repo, cacheLoc string) error {
 	if repo.CacheDir == "" {
 		repo.CacheDir = filepath.Join(
 			cacheLoc,
@@ -41,5 +30,5 @@ func PopulateRepo(repo *Repo, cacheLoc string) error {
 			"packages",
 		)
 	}
-	return getRepoRedis(c, repo)
+	return db.GetRepo(repo)
 }
@@ -15,7 +15,7 @@
 package pkginfo
 
 import (
-	"github.com/gomodule/redigo/redis"
+	"fmt"
 )
 
 // getRPMFromRepo returns a pointer to the RPM that matches the rpm name. If
@@ -31,27 +31,19 @@ func getRPMFromRepo(repo *Repo, rpm string) *RPM {
 
 // GetRPM fetches information about an RPM in a repo. Returns a pointer to the
 // associated RPM struct.
-func GetRPM(repo *Repo, rpm string) (*RPM, error) {
+func GetRPM(db Store, repo *Repo, rpm string) (*RPM, error) {
 	if r := getRPMFromRepo(repo, rpm); r != nil {
 		return r, nil
 	}
 
-	var c redis.Conn
-	var err error
-	if c, err = initRedis(0); err != nil {
-		return nil, err
-	}
-	defer func() {
-		_ = c.Close()
-	}()
-	return getRPMRedis(c, repo, rpm)
+	return db.GetRPM(repo, rpm)
 }
 
 // GetSRPMName returns the SRPMName field of the given rpm. The rpm specified
 // must be a binary or debuginfo RPM. If it is a source RPM or the RPM does not
 // exist in the Repo, an error is returned.
-func GetSRPMName(repo *Repo, rpm string) (string, error) {
-	r, err := GetRPM(repo, rpm)
+func GetSRPMName(db Store, repo *Repo, rpm string) (string, error) {
+	r, err := GetRPM(db, repo, rpm)
 	if err != nil {
 		return "", err
 	}
@@ -59,42 +51,61 @@ func GetSRPMName(repo *Repo, rpm string) (string, error) {
 	return r.SRPMName, nil
 }
 
-// GetRequires gets all runtime requirements for the given RPM. If the RPM is a
-// source RPM an error is returned.
-func GetRequires(repo *Repo, rpm string) ([]string, error) {
-	r, err := GetRPM(repo, rpm)
+// GetSRPM returns the source RPM that built the binary RPM named rpm. The
+// source RPM is looked up in srcRepo, which should be the source repo of the
+// same version as repo.
+func GetSRPM(db Store, repo, srcRepo *Repo, rpm string) (*RPM, error) {
+	r, err := GetRPM(db, repo, rpm)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.SRPMName == "" {
+		return nil, fmt.Errorf("%s is a source RPM", rpm)
+	}
+
+	return GetRPM(db, srcRepo, r.SRPMName)
+}
+
+// GetRequires gets the names of all runtime requirements for the given RPM,
+// without their version constraints. If the RPM is a source RPM an error is
+// returned.
+func GetRequires(db Store, repo *Repo, rpm string) ([]string, error) {
+	r, err := GetRPM(db, repo, rpm)
 	if err != nil {
 		return []string{}, nil
 	}
 
-	return r.Requires, nil
+	return dependencyNames(r.Requires), nil
 }
 
-// GetBuildRequires gets all build requirements for the given source RPM. If
-// the RPM is a binary or debuginfo RPM an error is returned.
-func GetBuildRequires(repo *Repo, rpm string) ([]string, error) {
-	r, err := GetRPM(repo, rpm)
+// GetBuildRequires gets the names of all build requirements for the given
+// source RPM, without their version constraints. If the RPM is a binary or
+// debuginfo RPM an error is returned.
+func GetBuildRequires(db Store, repo *Repo, rpm string) ([]string, error) {
+	r, err := GetRPM(db, repo, rpm)
 	if err != nil {
 		return []string{}, nil
 	}
 
-	return r.BuildRequires, nil
+	return dependencyNames(r.BuildRequires), nil
 }
 
-// GetProvides gets all symbols provided by the given RPM.
-func GetProvides(repo *Repo, rpm string) ([]string, error) {
-	r, err := GetRPM(repo, rpm)
+// GetProvides gets the names of all symbols provided by the given RPM, without
+// their versions.
+func GetProvides(db Store, repo *Repo, rpm string) ([]string, error) {
+	r, err := GetRPM(db, repo, rpm)
 	if err != nil {
 		return []string{}, nil
 	}
 
-	return r.Provides, nil
+	return dependencyNames(r.Provides), nil
 }
 
 // GetFiles gets the complete slice of files that are installed by the given
 // RPM.
-func GetFiles(repo *Repo, rpm string) ([]*File, error) {
-	r, err := GetRPM(repo, rpm)
+func GetFiles(db Store, repo *Repo, rpm string) ([]*File, error) {
+	r, err := GetRPM(db, repo, rpm)
 	if err != nil {
 		return []*File{}, nil
 	}
@@ -104,8 +115,8 @@ func GetFiles(repo *Repo, rpm string) ([]*File, error) {
 
 // GetFileNames gets the complete slice of filenames that are installed by the
 // given RPM.
-func GetFileNames(repo *Repo, rpm string) ([]string, error) {
-	fs, err := GetFiles(repo, rpm)
+func GetFileNames(db Store, repo *Repo, rpm string) ([]string, error) {
+	fs, err := GetFiles(db, repo, rpm)
 	if err != nil {
 		return []string{}, err
 	}
@@ -0,0 +1,262 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// Signature check outcomes for a single RPM
+const (
+	SignatureValid      = "valid"
+	SignatureUnsigned   = "unsigned"
+	SignatureUnknownKey = "unknown key"
+	SignatureBad        = "bad signature"
+)
+
+// SignatureCheck is the result of checking the signature of a single RPM
+// file. Signer is the identity of the signing key when Status is
+// SignatureValid. Err holds the reason a bad signature failed to verify.
+type SignatureCheck struct {
+	RPM    string
+	Status string
+	Signer string
+	Err    error
+}
+
+// ReadKeyring reads the armored or binary OpenPGP public keyring at path
+func ReadKeyring(path string) (openpgp.EntityList, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(b))
+	if err != nil {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(b))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read keyring %s: %s", path, err)
+	}
+	return keyring, nil
+}
+
+// signatureIssuer returns the ID of the key that created the OpenPGP signature
+// packet sig
+func signatureIssuer(sig []byte) (uint64, error) {
+	p, err := packet.Read(bytes.NewReader(sig))
+	if err != nil {
+		return 0, err
+	}
+
+	switch s := p.(type) {
+	case *packet.Signature:
+		if s.IssuerKeyId != nil {
+			return *s.IssuerKeyId, nil
+		}
+	case *packet.SignatureV3:
+		return s.IssuerKeyId, nil
+	}
+	return 0, fmt.Errorf("signature has no issuer key ID")
+}
+
+// signatureStatus classifies the RPM signature sig. Unsigned RPMs and RPMs
+// signed by a key that is not in keyring are reported without verifying
+// anything, otherwise verify is called to check the signature against the RPM
+// content.
+func signatureStatus(sig []byte, keyring openpgp.KeyRing, verify func() (string, error)) SignatureCheck {
+	if len(sig) == 0 {
+		return SignatureCheck{Status: SignatureUnsigned}
+	}
+
+	id, err := signatureIssuer(sig)
+	if err != nil {
+		return SignatureCheck{Status: SignatureBad, Err: err}
+	}
+	if len(keyring.KeysById(id)) == 0 {
+		return SignatureCheck{Status: SignatureUnknownKey, Err: fmt.Errorf("key ID %016X", id)}
+	}
+
+	signer, err := verify()
+	if err != nil {
+		return SignatureCheck{Status: SignatureBad, Err: err}
+	}
+	return SignatureCheck{Status: SignatureValid, Signer: signer}
+}
+
+// Tags of the signature header of an RPM that hold an OpenPGP signature, in
+// the order they are checked. Header only signatures are made over the main
+// header of the RPM, which holds the digests of the payload, while the legacy
+// header and payload signatures are made over the main header followed by the
+// payload.
+var signatureTags = []struct {
+	tag           uint32
+	headerPayload bool
+}{
+	{268, false}, // RPMSIGTAG_RSA
+	{267, false}, // RPMSIGTAG_DSA
+	{1002, true}, // RPMSIGTAG_PGP
+	{1005, true}, // RPMSIGTAG_GPG
+}
+
+const (
+	rpmLeadSize       = 96
+	rpmHeaderIntro    = 16
+	rpmIndexEntrySize = 16
+	rpmBinType        = 7
+)
+
+// readRPMHeader returns the size of the header structure starting at off in
+// r, along with the index entries and data store of the header
+func readRPMHeader(r io.ReaderAt, off int64) (int64, []byte, []byte, error) {
+	intro := make([]byte, rpmHeaderIntro)
+	if _, err := r.ReadAt(intro, off); err != nil {
+		return 0, nil, nil, fmt.Errorf("unable to read header: %v", err)
+	}
+	if !bytes.Equal(intro[:3], []byte{0x8e, 0xad, 0xe8}) {
+		return 0, nil, nil, fmt.Errorf("bad header magic at offset %d", off)
+	}
+	count := int64(binary.BigEndian.Uint32(intro[8:12]))
+	size := int64(binary.BigEndian.Uint32(intro[12:16]))
+
+	buf := make([]byte, count*rpmIndexEntrySize+size)
+	if _, err := r.ReadAt(buf, off+rpmHeaderIntro); err != nil {
+		return 0, nil, nil, fmt.Errorf("unable to read header: %v", err)
+	}
+	return rpmHeaderIntro + int64(len(buf)), buf[:count*rpmIndexEntrySize], buf[count*rpmIndexEntrySize:], nil
+}
+
+// rpmSignature returns the OpenPGP signature of the RPM in r, which has size
+// bytes, and the content it signs. The signature is empty when the RPM is
+// unsigned.
+func rpmSignature(r io.ReaderAt, size int64) ([]byte, io.Reader, error) {
+	sigSize, index, store, err := readRPMHeader(r, rpmLeadSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	sigs := make(map[uint32][]byte)
+	for i := 0; i < len(index); i += rpmIndexEntrySize {
+		tag := binary.BigEndian.Uint32(index[i:])
+		typ := binary.BigEndian.Uint32(index[i+4:])
+		off := binary.BigEndian.Uint32(index[i+8:])
+		count := binary.BigEndian.Uint32(index[i+12:])
+		if typ != rpmBinType || uint64(off)+uint64(count) > uint64(len(store)) {
+			continue
+		}
+		sigs[tag] = store[off : off+count]
+	}
+
+	// the signature header is padded to a multiple of 8 bytes
+	headerStart := rpmLeadSize + (sigSize+7)/8*8
+	headerSize, _, _, err := readRPMHeader(r, headerStart)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, t := range signatureTags {
+		sig, ok := sigs[t.tag]
+		if !ok {
+			continue
+		}
+		if t.headerPayload {
+			return sig, io.NewSectionReader(r, headerStart, size-headerStart), nil
+		}
+		return sig, io.NewSectionReader(r, headerStart, headerSize), nil
+	}
+	return nil, nil, nil
+}
+
+// CheckRPMSignature checks the signature of the RPM file at path against the
+// keys in keyring. The RSA or DSA signature of the header is checked when the
+// RPM has one, and the legacy signature of the header and payload otherwise.
+func CheckRPMSignature(path string, keyring openpgp.KeyRing) (SignatureCheck, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return SignatureCheck{}, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	fi, err := f.Stat()
+	if err != nil {
+		return SignatureCheck{}, err
+	}
+
+	sig, signed, err := rpmSignature(f, fi.Size())
+	if err != nil {
+		return SignatureCheck{}, fmt.Errorf("%s: %v", path, err)
+	}
+
+	res := signatureStatus(sig, keyring, func() (string, error) {
+		signer, err := openpgp.CheckDetachedSignature(keyring, signed, bytes.NewReader(sig))
+		if err != nil {
+			return "", err
+		}
+		var ids []string
+		for id := range signer.Identities {
+			ids = append(ids, id)
+		}
+		if len(ids) == 0 {
+			return fmt.Sprintf("%016X", signer.PrimaryKey.KeyId), nil
+		}
+		sort.Strings(ids)
+		return ids[0], nil
+	})
+	res.RPM = filepath.Base(path)
+	return res, nil
+}
+
+// CheckRepoSignatures checks the signature of every RPM cached for repo under
+// cacheLoc against the OpenPGP public keyring at keyringPath. The results are
+// sorted by RPM file name.
+func CheckRepoSignatures(repo *Repo, cacheLoc, keyringPath string) ([]SignatureCheck, error) {
+	if keyringPath == "" {
+		return nil, fmt.Errorf("no keyring configured, set keyring in the [paths] section of the configuration")
+	}
+	keyring, err := ReadKeyring(keyringPath)
+	if err != nil {
+		return nil, err
+	}
+
+	packagesDir := filepath.Join(cacheLoc, "rpms", repo.Name, repo.Version, repo.Type, "packages")
+	files, err := filepath.Glob(filepath.Join(packagesDir, "*.rpm"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no RPMs cached in %s", packagesDir)
+	}
+	sort.Strings(files)
+
+	var results []SignatureCheck
+	for _, f := range files {
+		res, err := CheckRPMSignature(f, keyring)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
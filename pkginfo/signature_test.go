@@ -0,0 +1,203 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+func newTestEntity(t *testing.T, name string) *openpgp.Entity {
+	e, err := openpgp.NewEntity(name, "", name+"@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func detachSign(t *testing.T, e *openpgp.Entity, content string) []byte {
+	var sig bytes.Buffer
+	if err := openpgp.DetachSign(&sig, e, strings.NewReader(content), nil); err != nil {
+		t.Fatal(err)
+	}
+	return sig.Bytes()
+}
+
+func TestSignatureStatus(t *testing.T) {
+	build := newTestEntity(t, "build")
+	other := newTestEntity(t, "other")
+	keyring := openpgp.EntityList{build}
+
+	valid := func() (string, error) { return "build", nil }
+	invalid := func() (string, error) { return "", errors.New("signature mismatch") }
+
+	testCases := []struct {
+		name     string
+		sig      []byte
+		verify   func() (string, error)
+		expected string
+	}{
+		{"unsigned", nil, valid, SignatureUnsigned},
+		{"unknown key", detachSign(t, other, "rpm"), valid, SignatureUnknownKey},
+		{"garbage", []byte("not a signature"), valid, SignatureBad},
+		{"bad", detachSign(t, build, "rpm"), invalid, SignatureBad},
+		{"valid", detachSign(t, build, "rpm"), valid, SignatureValid},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := signatureStatus(tc.sig, keyring, tc.verify)
+			if res.Status != tc.expected {
+				t.Errorf("expected %s but got %s (%v)", tc.expected, res.Status, res.Err)
+			}
+		})
+	}
+}
+
+// testRPMHeader returns an RPM header structure with a binary entry for each
+// tag in entries
+func testRPMHeader(entries map[uint32][]byte) []byte {
+	var tags []int
+	for tag := range entries {
+		tags = append(tags, int(tag))
+	}
+	sort.Ints(tags)
+
+	var index, store bytes.Buffer
+	for _, tag := range tags {
+		b := entries[uint32(tag)]
+		_ = binary.Write(&index, binary.BigEndian, []uint32{uint32(tag), rpmBinType, uint32(store.Len()), uint32(len(b))})
+		store.Write(b)
+	}
+
+	var h bytes.Buffer
+	h.Write([]byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
+	_ = binary.Write(&h, binary.BigEndian, []uint32{uint32(len(tags)), uint32(store.Len())})
+	h.Write(index.Bytes())
+	h.Write(store.Bytes())
+	return h.Bytes()
+}
+
+func TestCheckRPMSignature(t *testing.T) {
+	build := newTestEntity(t, "build")
+	other := newTestEntity(t, "other")
+	keyring := openpgp.EntityList{build}
+
+	header := string(testRPMHeader(map[uint32][]byte{1000: []byte("pkg")}))
+	payload := "payload"
+
+	testCases := []struct {
+		name     string
+		sigs     map[uint32][]byte
+		expected string
+	}{
+		{"unsigned", nil, SignatureUnsigned},
+		{"rsa header", map[uint32][]byte{268: detachSign(t, build, header)}, SignatureValid},
+		{"dsa header", map[uint32][]byte{267: detachSign(t, build, header)}, SignatureValid},
+		{"pgp header and payload", map[uint32][]byte{1002: detachSign(t, build, header+payload)}, SignatureValid},
+		{"header preferred", map[uint32][]byte{
+			268:  detachSign(t, build, header),
+			1002: []byte("not checked"),
+		}, SignatureValid},
+		{"tampered header", map[uint32][]byte{268: detachSign(t, build, header+"x")}, SignatureBad},
+		{"unknown key", map[uint32][]byte{268: detachSign(t, other, header)}, SignatureUnknownKey},
+	}
+
+	dir, err := ioutil.TempDir("", "pkginfo-rpm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sigHeader := testRPMHeader(tc.sigs)
+			var rpm bytes.Buffer
+			rpm.Write(make([]byte, rpmLeadSize))
+			rpm.Write(sigHeader)
+			rpm.Write(make([]byte, (8-len(sigHeader)%8)%8))
+			rpm.WriteString(header)
+			rpm.WriteString(payload)
+
+			path := filepath.Join(dir, "test.rpm")
+			if err := ioutil.WriteFile(path, rpm.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			res, err := CheckRPMSignature(path, keyring)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Status != tc.expected {
+				t.Errorf("expected %s but got %s (%v)", tc.expected, res.Status, res.Err)
+			}
+			if res.Status == SignatureValid && res.Signer != "build <build@example.com>" {
+				t.Errorf("unexpected signer %q", res.Signer)
+			}
+		})
+	}
+}
+
+func TestReadKeyring(t *testing.T) {
+	e := newTestEntity(t, "build")
+
+	dir, err := ioutil.TempDir("", "pkginfo-keyring-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	var binary, armored bytes.Buffer
+	if err = e.Serialize(&binary); err != nil {
+		t.Fatal(err)
+	}
+	w, err := armor.Encode(&armored, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, b := range map[string][]byte{"binary": binary.Bytes(), "armored": armored.Bytes()} {
+		path := filepath.Join(dir, name)
+		if err = ioutil.WriteFile(path, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		keyring, err := ReadKeyring(path)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if len(keyring.KeysById(e.PrimaryKey.KeyId)) != 1 {
+			t.Errorf("%s: expected key %X in keyring", name, e.PrimaryKey.KeyId)
+		}
+	}
+}
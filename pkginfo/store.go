@@ -0,0 +1,72 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/clearlinux/diva/internal/config"
+)
+
+const (
+	// RedisBackend stores package information in a running redis-server
+	RedisBackend = "redis"
+	// BoltBackend stores package information in a single file under the
+	// configured cache location
+	BoltBackend = "bolt"
+)
+
+// Store is a storage backend for imported Repo and RPM information. Every
+// backend must behave identically so callers do not need to know which one is
+// configured. Backends keep reverse indexes of the files, provides and
+// requires of every stored RPM so lookups do not need to load the whole repo,
+// storing an RPM again replaces its previous index entries.
+type Store interface {
+	// StoreRepo stores the repo and all of its packages
+	StoreRepo(repo *Repo) error
+	// StoreRPM stores a single rpm under the repo
+	StoreRPM(repo *Repo, rpm *RPM) error
+	// GetRepo populates repo.Packages with all RPMs stored for the repo. A
+	// repo that was never stored is not an error, it simply has no packages.
+	GetRepo(repo *Repo) error
+	// GetRPM returns the RPM named rpm stored under the repo, or an error if
+	// it does not exist.
+	GetRPM(repo *Repo, rpm string) (*RPM, error)
+	// FileOwners returns the sorted names of the RPMs under the repo that
+	// ship a file at path
+	FileOwners(repo *Repo, path string) ([]string, error)
+	// Providers returns the sorted names of the RPMs under the repo that
+	// provide capability, ignoring versions
+	Providers(repo *Repo, capability string) ([]string, error)
+	// Requirers returns the sorted names of the RPMs under the repo that
+	// require or build require capability, ignoring versions
+	Requirers(repo *Repo, capability string) ([]string, error)
+	// Close releases any resources held by the backend
+	Close() error
+}
+
+// OpenStore opens the storage backend selected by c.Storage.Backend. The
+// caller is responsible for closing the returned Store.
+func OpenStore(c *config.Config) (Store, error) {
+	switch c.Storage.Backend {
+	case "", RedisBackend:
+		return newRedisStore(c)
+	case BoltBackend:
+		return newBoltStore(filepath.Join(c.Paths.CacheLocation, "pkginfo.db"))
+	default:
+		return nil, fmt.Errorf("unknown storage backend %s", c.Storage.Backend)
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/diva/internal/config"
+)
+
+func newConformanceRepo() *Repo {
+	return &Repo{
+		URI:     "https://example.com/clear/x86_64/os/",
+		Name:    "divaconformance",
+		Version: "100",
+		Type:    "B",
+		Packages: []*RPM{
+			{
+				Name:         "testpkg",
+				Version:      "1.0",
+				Release:      "1",
+				Architecture: "x86_64",
+				SRPMName:     "testpkg-1.0-1.src.rpm",
+				License:      "MIT",
+				Requires: []Dependency{
+					{Name: "libc.so.6"},
+					{Name: "otherpkg", Flags: FlagGE, EVR: EVR{Epoch: "0", Version: "2.0"}},
+					// rich dependencies contain spaces
+					{Name: "(extrapkg if otherpkg)"},
+				},
+				Provides: []Dependency{
+					{Name: "testpkg", Flags: FlagEQ, EVR: EVR{Epoch: "0", Version: "1.0", Release: "1"}},
+					{Name: "libtest.so.1"},
+				},
+				Files: []*File{
+					{Name: "/usr/bin/test", Type: 'F', Size: 10, Hash: "abc", Permissions: "-rwxr-xr-x"},
+					{Name: "/usr/lib64/libtest.so.1", Type: 'L', SymlinkTarget: "libtest.so.1.0"},
+				},
+			},
+			{
+				Name:         "otherpkg",
+				Version:      "2.0",
+				Release:      "3",
+				Architecture: "x86_64",
+				SRPMName:     "otherpkg-2.0-3.src.rpm",
+				License:      "GPL-2.0",
+				Provides: []Dependency{
+					{Name: "otherpkg", Flags: FlagEQ, EVR: EVR{Epoch: "0", Version: "2.0", Release: "3"}},
+				},
+				Files: []*File{
+					{Name: "/usr/share/other", Type: 'D'},
+				},
+			},
+		},
+	}
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return strings.Join(a, "\n") == strings.Join(b, "\n")
+}
+
+// depStrings returns the spec file form of each dependency so they can be
+// compared with sameStrings
+func depStrings(deps []Dependency) []string {
+	var s []string
+	for _, d := range deps {
+		s = append(s, d.String())
+	}
+	return s
+}
+
+func checkRPM(t *testing.T, exp, got *RPM) {
+	if got == nil {
+		t.Fatalf("expected RPM %s but got nil", exp.Name)
+	}
+	if exp.Name != got.Name || exp.Version != got.Version || exp.Release != got.Release ||
+		exp.Architecture != got.Architecture || exp.SRPMName != got.SRPMName ||
+		exp.License != got.License {
+		t.Errorf("RPM metadata mismatch\nexpected: %+v\ngot: %+v", exp, got)
+	}
+	if !sameStrings(depStrings(exp.Requires), depStrings(got.Requires)) {
+		t.Errorf("%s requires: expected %v but got %v", exp.Name, exp.Requires, got.Requires)
+	}
+	if !sameStrings(depStrings(exp.Provides), depStrings(got.Provides)) {
+		t.Errorf("%s provides: expected %v but got %v", exp.Name, exp.Provides, got.Provides)
+	}
+
+	if len(exp.Files) != len(got.Files) {
+		t.Fatalf("%s: expected %d files but got %d", exp.Name, len(exp.Files), len(got.Files))
+	}
+	files := make(map[string]*File)
+	for _, f := range got.Files {
+		files[f.Name] = f
+	}
+	for _, f := range exp.Files {
+		g, ok := files[f.Name]
+		if !ok {
+			t.Errorf("%s: missing file %s", exp.Name, f.Name)
+			continue
+		}
+		if *f != *g {
+			t.Errorf("%s: file mismatch\nexpected: %+v\ngot: %+v", exp.Name, f, g)
+		}
+	}
+}
+
+// testStore is the conformance suite every Store implementation must pass
+func testStore(t *testing.T, s Store) {
+	repo := newConformanceRepo()
+	if err := s.StoreRepo(repo); err != nil {
+		t.Fatal(err)
+	}
+
+	// repo round trip
+	got := &Repo{Name: repo.Name, Version: repo.Version, Type: repo.Type}
+	if err := s.GetRepo(got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Packages) != len(repo.Packages) {
+		t.Fatalf("expected %d packages but got %d", len(repo.Packages), len(got.Packages))
+	}
+	for _, exp := range repo.Packages {
+		checkRPM(t, exp, getRPMFromRepo(got, exp.Name))
+	}
+
+	// single rpm lookups
+	p, err := s.GetRPM(repo, "otherpkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRPM(t, repo.Packages[1], p)
+
+	if p, err = s.GetRPM(repo, "notthere"); err == nil {
+		t.Errorf("expected error for non-existent RPM but got %+v", p)
+	}
+
+	// adding a single rpm to an existing repo
+	newRPM := &RPM{Name: "newpkg", Version: "1", Release: "1", Provides: []Dependency{{Name: "newpkg"}}}
+	if err = s.StoreRPM(repo, newRPM); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = s.GetRPM(repo, "newpkg"); err != nil {
+		t.Fatal(err)
+	}
+	checkRPM(t, newRPM, p)
+
+	testStoreIndexes(t, s, repo)
+
+	// a repo that was never stored has no packages but is not an error
+	empty := &Repo{Name: repo.Name, Version: "999999", Type: repo.Type}
+	if err = s.GetRepo(empty); err != nil {
+		t.Fatal(err)
+	}
+	if len(empty.Packages) != 0 {
+		t.Errorf("expected no packages but got %d", len(empty.Packages))
+	}
+}
+
+// testStoreIndexes checks the reverse lookups of the conformance repo
+func testStoreIndexes(t *testing.T, s Store, repo *Repo) {
+	lookups := []struct {
+		name     string
+		fn       func(*Repo, string) ([]string, error)
+		item     string
+		expected []string
+	}{
+		{"owners", s.FileOwners, "/usr/bin/test", []string{"testpkg"}},
+		{"owners", s.FileOwners, "/usr/bin/none", nil},
+		{"providers", s.Providers, "otherpkg", []string{"otherpkg"}},
+		{"providers", s.Providers, "libtest.so.1", []string{"testpkg"}},
+		{"requirers", s.Requirers, "otherpkg", []string{"testpkg"}},
+		{"requirers", s.Requirers, "(extrapkg if otherpkg)", []string{"testpkg"}},
+	}
+	for _, l := range lookups {
+		got, err := l.fn(repo, l.item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameStrings(got, l.expected) {
+			t.Errorf("%s of %s: expected %v but got %v", l.name, l.item, l.expected, got)
+		}
+	}
+
+	names, err := WhatRequires(s, &Repo{Name: repo.Name, Version: repo.Version, Type: repo.Type}, "otherpkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(names, []string{"testpkg"}) {
+		t.Errorf("expected testpkg to require otherpkg but got %v", names)
+	}
+
+	// storing a new version replaces the old index entries
+	updated := *repo.Packages[0]
+	updated.Requires = nil
+	updated.Files = []*File{{Name: "/usr/bin/test2", Type: 'F'}}
+	if err = s.StoreRPM(repo, &updated); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Requirers(repo, "otherpkg"); len(got) != 0 {
+		t.Errorf("expected no requirers after update but got %v", got)
+	}
+	if got, _ := s.FileOwners(repo, "/usr/bin/test"); len(got) != 0 {
+		t.Errorf("expected no owners after update but got %v", got)
+	}
+	if got, _ := s.FileOwners(repo, "/usr/bin/test2"); !sameStrings(got, []string{"testpkg"}) {
+		t.Errorf("expected testpkg to own /usr/bin/test2 but got %v", got)
+	}
+	if p, err := s.GetRPM(repo, "testpkg"); err != nil || len(p.Files) != 1 {
+		t.Errorf("expected updated RPM with 1 file but got %+v (%v)", p, err)
+	}
+
+	// restore the original for any later checks
+	if err = s.StoreRPM(repo, repo.Packages[0]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBoltStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkginfo-bolt-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	s, err := newBoltStore(filepath.Join(dir, "pkginfo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = s.Close()
+	}()
+
+	testStore(t, s)
+}
+
+// TestRedisStore runs against the redis-server on localhost, and flushes its
+// database 15 when done. It only runs when DIVA_TEST_REDIS is set, so it never
+// touches a redis-server that was not meant for it.
+func TestRedisStore(t *testing.T) {
+	if os.Getenv("DIVA_TEST_REDIS") == "" {
+		t.Skip("set DIVA_TEST_REDIS to test against the redis-server on localhost")
+	}
+
+	c := &config.Config{}
+	// stay out of the way of real data in the default database
+	c.Redis.DB = 15
+	s, err := newRedisStore(c)
+	if err != nil {
+		t.Skipf("redis-server not available: %s", err)
+	}
+	defer func() {
+		if _, err := s.c.Do("FLUSHDB"); err != nil {
+			t.Errorf("failed to flush the test database: %s", err)
+		}
+		_ = s.Close()
+	}()
+
+	testStore(t, s)
+}
+
+func TestSpawnedRedisStore(t *testing.T) {
+	if _, err := exec.LookPath("redis-server"); err != nil {
+		t.Skip("redis-server not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "pkginfo-redis-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	c := &config.Config{}
+	c.Paths.CacheLocation = dir
+	c.Redis.Spawn = true
+	s, err := newRedisStore(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.server == nil {
+		t.Fatal("expected a private redis-server to be started")
+	}
+
+	testStore(t, s)
+
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "redis", "pkginfo.rdb")); err != nil {
+		t.Errorf("expected data to be saved on shutdown: %s", err)
+	}
+}
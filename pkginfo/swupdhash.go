@@ -0,0 +1,224 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// file type bits of a cpio mode, which is a raw st_mode
+const (
+	modeTypeMask = 0170000
+	modeDir      = 0040000
+	modeFile     = 0100000
+	modeLink     = 0120000
+)
+
+// systemIDs maps the owner and group names recorded in RPM headers to their
+// numeric ids. Only root is known without the passwd and group files of the
+// target system, so files owned by anything else get no swupd hash.
+var systemIDs = map[string]uint64{
+	"root": 0,
+}
+
+// swupdStat is the update_stat struct swupd hashes together with the file
+// data, in the same field order
+type swupdStat struct {
+	Mode uint64
+	UID  uint64
+	GID  uint64
+	Rdev uint64
+	Size uint64
+}
+
+// swupdHash returns the swupd hash of a file with stat st and content data.
+// The data is an HMAC-SHA256 keyed with the hex HMAC-SHA256 of the stat, so
+// the mode and ownership of a file change its hash as much as its content.
+// This is the algorithm swupd.Hashcalc applies to a file on disk.
+func swupdHash(st swupdStat, data io.Reader) (string, error) {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, st); err != nil {
+		return "", err
+	}
+	key := hmac.New(sha256.New, buf.Bytes())
+
+	mac := hmac.New(sha256.New, []byte(hex.EncodeToString(key.Sum(nil))))
+	if _, err := io.Copy(mac, data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// cpioHeader is the header of a single entry of a newc cpio archive, the
+// format of RPM payloads
+type cpioHeader struct {
+	name  string
+	ino   uint64
+	mode  uint64
+	nlink uint64
+	size  uint64
+}
+
+// cpioTrailer is the name of the entry ending a cpio archive
+const cpioTrailer = "TRAILER!!!"
+
+// cpioPad returns the padding needed to align n to four bytes
+func cpioPad(n uint64) int64 {
+	return int64((4 - n%4) % 4)
+}
+
+func readCpioHeader(r *bufio.Reader) (*cpioHeader, error) {
+	raw := make([]byte, 110)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, err
+	}
+	magic := string(raw[:6])
+	if magic != "070701" && magic != "070702" {
+		return nil, fmt.Errorf("unsupported cpio format %q", magic)
+	}
+
+	// the header is thirteen 8 digit hex fields following the magic
+	var fields [13]uint64
+	for i := range fields {
+		v, err := strconv.ParseUint(string(raw[6+8*i:14+8*i]), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed cpio header: %v", err)
+		}
+		fields[i] = v
+	}
+
+	nameSize := fields[11]
+	name := make([]byte, nameSize)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return nil, err
+	}
+	if _, err := r.Discard(int(cpioPad(110 + nameSize))); err != nil {
+		return nil, err
+	}
+
+	return &cpioHeader{
+		name:  strings.TrimSuffix(string(name), "\x00"),
+		ino:   fields[0],
+		mode:  fields[1],
+		nlink: fields[4],
+		size:  fields[6],
+	}, nil
+}
+
+// setSwupdHashes sets the SwupdHash of the files in the cpio payload read from
+// r. The payload only records the mode of each file, ownership comes from the
+// RPM header the files were read from. Files that are not in the payload, such
+// as ghost files, and files of unsupported types or owners are left without a
+// hash.
+func setSwupdHashes(r io.Reader, files []*File) error {
+	byName := make(map[string]*File)
+	for _, f := range files {
+		byName[f.Name] = f
+	}
+
+	// all but the last entry of a set of hard links carry no data, they are
+	// hashed once the data is found
+	pending := make(map[uint64][]*File)
+
+	br := bufio.NewReader(r)
+	for {
+		h, err := readCpioHeader(br)
+		if err != nil {
+			return err
+		}
+		if h.name == cpioTrailer {
+			return nil
+		}
+
+		f := byName[strings.TrimPrefix(h.name, ".")]
+		var uid, gid uint64
+		hashable := false
+		if f != nil {
+			var uidOK, gidOK bool
+			uid, uidOK = systemIDs[f.Owner]
+			gid, gidOK = systemIDs[f.Group]
+			hashable = uidOK && gidOK
+		}
+		st := swupdStat{Mode: h.mode, UID: uid, GID: gid, Size: h.size}
+		content := &io.LimitedReader{R: br, N: int64(h.size)}
+
+		var data io.Reader = content
+		switch h.mode & modeTypeMask {
+		case modeFile:
+			if h.size == 0 && h.nlink > 1 && hashable {
+				pending[h.ino] = append(pending[h.ino], f)
+				hashable = false
+			}
+		case modeDir:
+			st.Size = 0
+			data = strings.NewReader("DIRECTORY")
+		case modeLink:
+			// the data of a symlink is its target
+		default:
+			hashable = false
+		}
+
+		if hashable {
+			f.SwupdHash, err = swupdHash(st, data)
+			if err != nil {
+				return err
+			}
+			// hard links share the inode, and with it the hash
+			for _, link := range pending[h.ino] {
+				link.SwupdHash = f.SwupdHash
+			}
+			delete(pending, h.ino)
+		}
+
+		// skip the data that was not hashed, plus the padding
+		if _, err = io.CopyN(ioutil.Discard, br, content.N+cpioPad(h.size)); err != nil {
+			return err
+		}
+	}
+}
+
+// addSwupdHashes extracts the payload of the RPM file at path with rpm2cpio
+// and sets the SwupdHash of the files of rpm
+func addSwupdHashes(rpm *RPM, path string) error {
+	cmd := exec.Command("rpm2cpio", path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	err = setSwupdHashes(out, rpm.Files)
+	// drain the pipe so rpm2cpio can exit before waiting on it
+	_, _ = io.Copy(ioutil.Discard, out)
+	if werr := cmd.Wait(); werr != nil && err == nil {
+		err = fmt.Errorf("rpm2cpio %s: %v: %s", path, werr, strings.TrimSpace(stderr.String()))
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// writeCpioEntry appends a newc cpio entry to buf
+func writeCpioEntry(buf *bytes.Buffer, name string, ino, mode, nlink uint64, data string) {
+	name += "\x00"
+	fmt.Fprintf(buf, "070701%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+		ino, mode, 0, 0, nlink, 0, len(data), 0, 0, 0, 0, len(name), 0)
+	buf.WriteString(name)
+	buf.Write(make([]byte, cpioPad(uint64(110+len(name)))))
+	buf.WriteString(data)
+	buf.Write(make([]byte, cpioPad(uint64(len(data)))))
+}
+
+func TestSwupdHash(t *testing.T) {
+	testCases := []struct {
+		name     string
+		st       swupdStat
+		data     string
+		expected string
+	}{
+		{
+			"file",
+			swupdStat{Mode: 0100644, Size: 5},
+			"hello",
+			"2d4c7831a22e501bd346ce30bd59c8afdcc437f9b4ee061568b24c8ad1529fa6",
+		},
+		{
+			"directory",
+			swupdStat{Mode: 040755},
+			"DIRECTORY",
+			"6c27df6efcd6fc401ff1bc67c970b83eef115f6473db4fb9d57e5de317eba96e",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hash, err := swupdHash(tc.st, strings.NewReader(tc.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash != tc.expected {
+				t.Errorf("expected %s but got %s", tc.expected, hash)
+			}
+		})
+	}
+}
+
+func TestSetSwupdHashes(t *testing.T) {
+	var payload bytes.Buffer
+	writeCpioEntry(&payload, "./usr/bin/tool", 1, 0100755, 1, "binary")
+	writeCpioEntry(&payload, "./usr/share/dir", 2, 040755, 2, "")
+	writeCpioEntry(&payload, "./usr/lib/link", 3, 0120777, 1, "tool")
+	writeCpioEntry(&payload, "./usr/bin/hard1", 4, 0100755, 2, "")
+	writeCpioEntry(&payload, "./usr/bin/hard2", 4, 0100755, 2, "shared")
+	writeCpioEntry(&payload, "./usr/bin/games", 5, 0100755, 1, "fun")
+	writeCpioEntry(&payload, cpioTrailer, 0, 0, 1, "")
+
+	files := []*File{
+		{Name: "/usr/bin/tool", Owner: "root", Group: "root"},
+		{Name: "/usr/share/dir", Owner: "root", Group: "root"},
+		{Name: "/usr/lib/link", Owner: "root", Group: "root"},
+		{Name: "/usr/bin/hard1", Owner: "root", Group: "root"},
+		{Name: "/usr/bin/hard2", Owner: "root", Group: "root"},
+		{Name: "/usr/bin/games", Owner: "root", Group: "games"},
+		{Name: "/var/ghost", Owner: "root", Group: "root"},
+	}
+	if err := setSwupdHashes(&payload, files); err != nil {
+		t.Fatal(err)
+	}
+
+	hash := func(mode, size uint64, data string) string {
+		h, _ := swupdHash(swupdStat{Mode: mode, Size: size}, strings.NewReader(data))
+		return h
+	}
+	expected := []string{
+		hash(0100755, 6, "binary"),
+		hash(040755, 0, "DIRECTORY"),
+		hash(0120777, 4, "tool"),
+		hash(0100755, 6, "shared"),
+		hash(0100755, 6, "shared"),
+		"",
+		"",
+	}
+	for i, f := range files {
+		if f.SwupdHash != expected[i] {
+			t.Errorf("expected %s hash %q but got %q", f.Name, expected[i], f.SwupdHash)
+		}
+	}
+}
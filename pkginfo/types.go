@@ -15,7 +15,8 @@
 package pkginfo
 
 // Repo defines the location, name, type, and other metadata about an RPM
-// repository, as well as a slice of pointers to RPMs
+// repository, as well as a slice of pointers to RPMs. Type is "B" for binary
+// repos and "S" for source repos.
 type Repo struct {
 	URI      string
 	Name     string
@@ -29,23 +30,56 @@ type Repo struct {
 // RPM is a packaging format that encapsulates a collection of files to install
 // and assorted metadata. An RPM can be either a binary or source RPM. If
 // SRPMName is empty this indicates the RPM is already a source RPM. For binary
-// RPMs it will be populated with that RPMs associated source RPM name.
+// RPMs it will be populated with the package name of that RPMs associated
+// source RPM, which can be looked up in the source repo of the same version.
+// BuildRequires is only populated for source RPMs. Checksum, ChecksumType and
+// Location are the package checksum and path relative to the repo URI as
+// listed in the repo metadata.
 type RPM struct {
 	Name          string
+	Epoch         int
 	Version       string
 	Release       string
 	Architecture  string
 	SRPMName      string
 	License       string
-	Requires      []string
-	BuildRequires []string
-	Provides      []string
+	Requires      []Dependency
+	BuildRequires []Dependency
+	Provides      []Dependency
+	Conflicts     []Dependency
+	Obsoletes     []Dependency
+	PackageSize   uint
+	InstalledSize uint
+	ArchiveSize   uint
+	Checksum      string
+	ChecksumType  string
+	Location      string
 	Files         []*File
 }
 
+// EVR is the epoch, version and release of a package or dependency. An empty
+// Epoch is treated as 0. An empty Release matches any release when comparing
+// dependencies.
+type EVR struct {
+	Epoch   string
+	Version string
+	Release string
+}
+
+// Dependency is a single requires, provides, conflicts or obsoletes entry of
+// an RPM. Flags is one of the FlagEQ, FlagLT, FlagLE, FlagGT or FlagGE
+// comparison operators, or empty for an unversioned dependency, in which case
+// EVR is unset.
+type Dependency struct {
+	Name  string
+	Flags string
+	EVR   EVR
+}
+
 // File contains all information for a file in an RPM.
 // Additional fields Name, Type, SwupdHash, and CurrentVersion are used by
-// swupd operations.
+// swupd operations. SwupdHash is only set for files imported from the RPM
+// payload and owned by root.
 type File struct {
 	Name           string
 	Type           byte
@@ -0,0 +1,171 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/clearlinux/diva/internal/helpers"
+)
+
+// RepoIntegrity is the result of verifying the RPMs cached for a repo against
+// its metadata. Each entry is an RPM file name in the repo packages directory.
+// Corrupt RPMs do not match the metadata checksum, Missing RPMs are listed in
+// the metadata but not cached and Extra RPMs are cached but not listed.
+type RepoIntegrity struct {
+	Verified []string
+	Corrupt  []string
+	Missing  []string
+	Extra    []string
+}
+
+func newChecksumHash(sumType string) (hash.Hash, error) {
+	switch sumType {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "sha", "sha1":
+		return sha1.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported checksum type %s", sumType)
+}
+
+// checksumFile returns the hex encoded sumType checksum of the file at path
+func checksumFile(path, sumType string) (string, error) {
+	h, err := newChecksumHash(sumType)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyRPMFile reports whether the file at path matches the checksum of r
+// from the repo metadata. An RPM without a checksum cannot be verified and is
+// always reported as matching.
+func verifyRPMFile(path string, r *RPM) (bool, error) {
+	if r.Checksum == "" {
+		_, err := os.Stat(path)
+		return err == nil, err
+	}
+
+	sum, err := checksumFile(path, r.ChecksumType)
+	if err != nil {
+		return false, err
+	}
+	return sum == r.Checksum, nil
+}
+
+// downloadVerifiedRPM downloads r from url to outFile unless a copy matching
+// the repo metadata checksum is already there. A cached copy that does not
+// match is downloaded again, and an error is returned if the new download does
+// not match either.
+func downloadVerifiedRPM(url, outFile string, r *RPM) error {
+	ok, err := verifyRPMFile(outFile, r)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if ok {
+		return nil
+	}
+
+	if err = helpers.Download(url, outFile, true); err != nil {
+		return err
+	}
+
+	if ok, err = verifyRPMFile(outFile, r); err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s does not match the %s checksum in the repo metadata",
+			filepath.Base(outFile), r.ChecksumType)
+	}
+	return nil
+}
+
+// VerifyRepoCache verifies the RPMs cached for repo under cacheLoc against the
+// checksums in the cached repo metadata. The repo must have been downloaded
+// with DownloadRepoFiles.
+func VerifyRepoCache(repo *Repo, cacheLoc string) (*RepoIntegrity, error) {
+	workingDir := filepath.Join(cacheLoc, "rpms", repo.Name, repo.Version, repo.Type)
+	_, rpms, err := parsePrimary(filepath.Join(workingDir, "primary.xml"))
+	if err != nil {
+		return nil, err
+	}
+
+	packagesDir := filepath.Join(workingDir, "packages")
+	cached := make(map[string]bool)
+	files, err := ioutil.ReadDir(packagesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, fi := range files {
+		if filepath.Ext(fi.Name()) == ".rpm" {
+			cached[fi.Name()] = true
+		}
+	}
+
+	res := &RepoIntegrity{}
+	for _, r := range rpms {
+		name := filepath.Base(r.Location)
+		if !cached[name] {
+			res.Missing = append(res.Missing, name)
+			continue
+		}
+		delete(cached, name)
+
+		ok, err := verifyRPMFile(filepath.Join(packagesDir, name), r)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res.Verified = append(res.Verified, name)
+		} else {
+			res.Corrupt = append(res.Corrupt, name)
+		}
+	}
+
+	for name := range cached {
+		res.Extra = append(res.Extra, name)
+	}
+
+	sort.Strings(res.Verified)
+	sort.Strings(res.Corrupt)
+	sort.Strings(res.Missing)
+	sort.Strings(res.Extra)
+	return res, nil
+}
@@ -0,0 +1,148 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+const verifyPrimaryPackage = `<package type="rpm">
+  <name>%[1]s</name>
+  <arch>x86_64</arch>
+  <version epoch="0" ver="1" rel="1"/>
+  <checksum type="sha256" pkgid="YES">%[2]s</checksum>
+  <location href="Packages/%[1]s-1-1.x86_64.rpm"/>
+  <format><rpm:sourcerpm>%[1]s-1-1.src.rpm</rpm:sourcerpm></format>
+</package>
+`
+
+func TestVerifyRepoCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkginfo-verify-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	repo := &Repo{Name: "clear", Version: "10", Type: "B"}
+	workingDir := filepath.Join(dir, "rpms", "clear", "10", "B")
+	packagesDir := filepath.Join(workingDir, "packages")
+	if err = os.MkdirAll(packagesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var primary strings.Builder
+	primary.WriteString(`<metadata xmlns="http://linux.duke.edu/metadata/common" xmlns:rpm="http://linux.duke.edu/metadata/rpm">`)
+	for _, name := range []string{"good", "corrupt", "missing"} {
+		primary.WriteString(fmt.Sprintf(verifyPrimaryPackage, name, sha256Hex(name)))
+	}
+	primary.WriteString("</metadata>")
+	if err = ioutil.WriteFile(filepath.Join(workingDir, "primary.xml"), []byte(primary.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cached := map[string]string{
+		"good-1-1.x86_64.rpm":    "good",
+		"corrupt-1-1.x86_64.rpm": "corr",
+		"extra-1-1.x86_64.rpm":   "extra",
+	}
+	for name, content := range cached {
+		if err = ioutil.WriteFile(filepath.Join(packagesDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := VerifyRepoCache(repo, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sameStrings(res.Verified, []string{"good-1-1.x86_64.rpm"}) {
+		t.Errorf("unexpected verified RPMs %v", res.Verified)
+	}
+	if !sameStrings(res.Corrupt, []string{"corrupt-1-1.x86_64.rpm"}) {
+		t.Errorf("unexpected corrupt RPMs %v", res.Corrupt)
+	}
+	if !sameStrings(res.Missing, []string{"missing-1-1.x86_64.rpm"}) {
+		t.Errorf("unexpected missing RPMs %v", res.Missing)
+	}
+	if !sameStrings(res.Extra, []string{"extra-1-1.x86_64.rpm"}) {
+		t.Errorf("unexpected extra RPMs %v", res.Extra)
+	}
+}
+
+func TestDownloadVerifiedRPM(t *testing.T) {
+	downloads := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		_, _ = w.Write([]byte("content"))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "pkginfo-download-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	out := filepath.Join(dir, "test.rpm")
+	r := &RPM{Checksum: sha256Hex("content"), ChecksumType: "sha256"}
+
+	// a truncated cached copy is replaced
+	if err = ioutil.WriteFile(out, []byte("cont"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = downloadVerifiedRPM(ts.URL, out, r); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "content" {
+		t.Errorf("expected corrupt RPM to be replaced but got %q", b)
+	}
+
+	// a valid cached copy is not downloaded again
+	if err = downloadVerifiedRPM(ts.URL, out, r); err != nil {
+		t.Fatal(err)
+	}
+	if downloads != 1 {
+		t.Errorf("expected 1 download but got %d", downloads)
+	}
+
+	// a download that does not match is an error
+	r.Checksum = sha256Hex("other")
+	if err = downloadVerifiedRPM(ts.URL, out, r); err == nil {
+		t.Error("expected checksum mismatch error")
+	}
+}
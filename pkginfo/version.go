@@ -0,0 +1,270 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Dependency comparison flags as used in repo metadata. An unversioned
+// dependency has empty Flags.
+const (
+	FlagEQ = "EQ"
+	FlagLT = "LT"
+	FlagLE = "LE"
+	FlagGT = "GT"
+	FlagGE = "GE"
+)
+
+const (
+	senseLess = 1 << iota
+	senseGreater
+	senseEqual
+)
+
+var flagSense = map[string]int{
+	FlagEQ: senseEqual,
+	FlagLT: senseLess,
+	FlagLE: senseLess | senseEqual,
+	FlagGT: senseGreater,
+	FlagGE: senseGreater | senseEqual,
+}
+
+var flagOperator = map[string]string{
+	FlagEQ: "=",
+	FlagLT: "<",
+	FlagLE: "<=",
+	FlagGT: ">",
+	FlagGE: ">=",
+}
+
+// String returns the EVR in [epoch:]version[-release] form
+func (e EVR) String() string {
+	s := e.Version
+	if e.Epoch != "" && e.Epoch != "0" {
+		s = e.Epoch + ":" + s
+	}
+	if e.Release != "" {
+		s += "-" + e.Release
+	}
+	return s
+}
+
+// String returns the dependency the way it would be written in a spec file,
+// for example "foo >= 2.0-1"
+func (d Dependency) String() string {
+	if d.Flags == "" {
+		return d.Name
+	}
+	return fmt.Sprintf("%s %s %s", d.Name, flagOperator[d.Flags], d.EVR)
+}
+
+// EVR returns the epoch, version and release of the RPM
+func (r *RPM) EVR() EVR {
+	return EVR{
+		Epoch:   strconv.Itoa(r.Epoch),
+		Version: r.Version,
+		Release: r.Release,
+	}
+}
+
+func isAlnum(c byte) bool {
+	return c < unicode.MaxASCII && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)))
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// segment returns the leading run of bytes in s that satisfy fn
+func segment(s string, fn func(byte) bool) string {
+	i := 0
+	for i < len(s) && fn(s[i]) {
+		i++
+	}
+	return s[:i]
+}
+
+// CompareVersions compares two version or release strings using the same
+// algorithm as rpmvercmp. It returns 1 if a is newer, -1 if b is newer and 0
+// if they are equal.
+func CompareVersions(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	for len(a) > 0 || len(b) > 0 {
+		a = strings.TrimLeftFunc(a, func(r rune) bool { return r < unicode.MaxASCII && !isAlnum(byte(r)) && r != '~' && r != '^' })
+		b = strings.TrimLeftFunc(b, func(r rune) bool { return r < unicode.MaxASCII && !isAlnum(byte(r)) && r != '~' && r != '^' })
+
+		// tilde sorts before everything else, including the end of the
+		// string
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		// caret sorts after the end of the string but before everything
+		// else
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			if len(a) == 0 {
+				return -1
+			}
+			if len(b) == 0 {
+				return 1
+			}
+			if !strings.HasPrefix(a, "^") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "^") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		if len(a) == 0 || len(b) == 0 {
+			break
+		}
+
+		isNum := isDigit(a[0])
+		fn := func(c byte) bool { return isAlnum(c) && !isDigit(c) }
+		if isNum {
+			fn = isDigit
+		}
+		segA := segment(a, fn)
+		segB := segment(b, fn)
+		a, b = a[len(segA):], b[len(segB):]
+
+		// numeric segments are always newer than alpha segments
+		if len(segB) == 0 {
+			if isNum {
+				return 1
+			}
+			return -1
+		}
+
+		if isNum {
+			segA = strings.TrimLeft(segA, "0")
+			segB = strings.TrimLeft(segB, "0")
+			if len(segA) != len(segB) {
+				if len(segA) > len(segB) {
+					return 1
+				}
+				return -1
+			}
+		}
+
+		if c := strings.Compare(segA, segB); c != 0 {
+			return c
+		}
+	}
+
+	// whichever version still has characters left over wins
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+	if len(a) > 0 {
+		return 1
+	}
+	return -1
+}
+
+func compareEpochs(a, b string) int {
+	ea, _ := strconv.Atoi(a)
+	eb, _ := strconv.Atoi(b)
+	switch {
+	case ea > eb:
+		return 1
+	case ea < eb:
+		return -1
+	}
+	return 0
+}
+
+// CompareEVR compares the epoch, version and release of a and b. A missing
+// epoch is treated as 0. It returns 1 if a is newer, -1 if b is newer and 0 if
+// they are equal.
+func CompareEVR(a, b EVR) int {
+	if c := compareEpochs(a.Epoch, b.Epoch); c != 0 {
+		return c
+	}
+	if c := CompareVersions(a.Version, b.Version); c != 0 {
+		return c
+	}
+	return CompareVersions(a.Release, b.Release)
+}
+
+// compareDependencyEVR compares a and b like CompareEVR, except the release
+// is only compared when both sides specify one, so that "foo >= 2.0" is
+// satisfied by foo-2.0-1.
+func compareDependencyEVR(a, b EVR) int {
+	if a.Release == "" || b.Release == "" {
+		a.Release, b.Release = "", ""
+	}
+	return CompareEVR(a, b)
+}
+
+// Overlaps reports whether the version ranges of the two dependencies
+// intersect, which is how rpm decides if a provide satisfies a requirement.
+// Both dependencies must have the same name. An unversioned dependency
+// overlaps with any version.
+func (d Dependency) Overlaps(o Dependency) bool {
+	if d.Name != o.Name {
+		return false
+	}
+	if d.Flags == "" || o.Flags == "" {
+		return true
+	}
+
+	ds, os := flagSense[d.Flags], flagSense[o.Flags]
+	switch sense := compareDependencyEVR(d.EVR, o.EVR); {
+	case sense < 0:
+		return ds&senseGreater != 0 || os&senseLess != 0
+	case sense > 0:
+		return ds&senseLess != 0 || os&senseGreater != 0
+	default:
+		return ds&os != 0
+	}
+}
+
+// Satisfies reports whether any of the RPMs provides satisfy the requirement
+// req
+func (r *RPM) Satisfies(req Dependency) bool {
+	for _, p := range r.Provides {
+		if p.Overlaps(req) {
+			return true
+		}
+	}
+	return false
+}
+
+// dependencyNames returns the names of deps, dropping any version constraints
+func dependencyNames(deps []Dependency) []string {
+	var names []string
+	for _, d := range deps {
+		names = append(names, d.Name)
+	}
+	return names
+}
@@ -0,0 +1,107 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkginfo
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "2.0", -1},
+		{"2.0", "1.0", 1},
+		{"2.0.1", "2.0", 1},
+		{"1.10", "1.9", 1},
+		{"1.010", "1.10", 0},
+		{"1.0a", "1.0", 1},
+		{"1.0", "1.0a", -1},
+		{"1a", "1.0", -1},
+		{"5.5p1", "5.5p10", -1},
+		{"xyz.4", "8", -1},
+		{"1.0_1", "1.0.1", 0},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0^git1", "1.0", 1},
+		{"1.0^git1", "1.0.1", -1},
+		{"1.0^git1", "1.0~rc1", 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.a+" vs "+tc.b, func(t *testing.T) {
+			if got := CompareVersions(tc.a, tc.b); got != tc.expected {
+				t.Errorf("expected %d but got %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestCompareEVR(t *testing.T) {
+	testCases := []struct {
+		a, b     EVR
+		expected int
+	}{
+		{EVR{"", "1.0", "1"}, EVR{"0", "1.0", "1"}, 0},
+		{EVR{"1", "1.0", "1"}, EVR{"0", "2.0", "1"}, 1},
+		{EVR{"0", "1.0", "2"}, EVR{"0", "1.0", "10"}, -1},
+		{EVR{"0", "1.0", ""}, EVR{"0", "1.0", "1"}, -1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.a.String()+" vs "+tc.b.String(), func(t *testing.T) {
+			if got := CompareEVR(tc.a, tc.b); got != tc.expected {
+				t.Errorf("expected %d but got %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestSatisfies(t *testing.T) {
+	foo := &RPM{
+		Name:    "foo",
+		Version: "1.9",
+		Release: "3",
+		Provides: []Dependency{
+			{Name: "foo", Flags: FlagEQ, EVR: EVR{"0", "1.9", "3"}},
+			{Name: "libfoo.so.1"},
+		},
+	}
+
+	testCases := []struct {
+		req      Dependency
+		expected bool
+	}{
+		{Dependency{Name: "foo"}, true},
+		{Dependency{Name: "bar"}, false},
+		{Dependency{Name: "foo", Flags: FlagGE, EVR: EVR{Version: "2.0"}}, false},
+		{Dependency{Name: "foo", Flags: FlagGE, EVR: EVR{Version: "1.9"}}, true},
+		{Dependency{Name: "foo", Flags: FlagLT, EVR: EVR{Version: "2.0"}}, true},
+		{Dependency{Name: "foo", Flags: FlagGT, EVR: EVR{Version: "1.9"}}, false},
+		{Dependency{Name: "foo", Flags: FlagEQ, EVR: EVR{Version: "1.9"}}, true},
+		{Dependency{Name: "foo", Flags: FlagEQ, EVR: EVR{Version: "1.9", Release: "2"}}, false},
+		{Dependency{Name: "foo", Flags: FlagLE, EVR: EVR{Epoch: "1", Version: "1.0"}}, true},
+		// unversioned provides satisfy any version of a requirement
+		{Dependency{Name: "libfoo.so.1", Flags: FlagGE, EVR: EVR{Version: "5"}}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.req.String(), func(t *testing.T) {
+			if got := foo.Satisfies(tc.req); got != tc.expected {
+				t.Errorf("expected %v but got %v", tc.expected, got)
+			}
+		})
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
@@ -55,6 +56,35 @@ func CheckManifestHashes(r *diva.Results, c *config.Config, version, minVer uint
 	return nil
 }
 
+// LoadBundleManifests parses every bundle manifest listed in the MoM for
+// version, regardless of the version the manifest was last changed in.
+// Manifests that are not cached yet are downloaded from the upstream URL.
+func LoadBundleManifests(c *config.Config, version uint) ([]*swupd.Manifest, error) {
+	cLoc := filepath.Join(c.Paths.CacheLocation, "update")
+	momPath := filepath.Join(cLoc, fmt.Sprint(version), "Manifest.MoM")
+	MoM, err := swupd.ParseManifestFile(momPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []*swupd.Manifest
+	for i := range MoM.Files {
+		ver := fmt.Sprint(MoM.Files[i].Version)
+		mPath := filepath.Join(cLoc, ver, "Manifest."+MoM.Files[i].Name)
+		err = helpers.DownloadManifest(c.UpstreamURL, ver, MoM.Files[i].Name, mPath)
+		if err != nil {
+			return nil, err
+		}
+		m, err := swupd.ParseManifestFile(mPath)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, m)
+	}
+
+	return manifests, nil
+}
+
 func checkBundleFileHashes(cacheLoc string, m *swupd.Manifest, minVer uint) ([]string, error) {
 	var wg sync.WaitGroup
 	workers := len(m.Files)
@@ -151,9 +181,10 @@ func CheckFileHashes(r *diva.Results, c *config.Config, version, minVer uint) er
 					break
 				}
 				desc := fmt.Sprintf("file hashes for %s bundle match hashes in manifest", m.Name)
-				r.Ok(len(failures) == 0, desc)
 				if len(failures) > 0 {
-					r.Diagnostic("mismatched hashes:\n" + strings.Join(failures, "\n"))
+					r.Ok(false, desc, "mismatched hashes:\n"+strings.Join(failures, "\n"))
+				} else {
+					r.Ok(true, desc)
 				}
 			}
 		}()
@@ -336,15 +367,28 @@ func checkDeltaPack(c *config.Config, dir string, m *swupd.Manifest) error {
 	return nil
 }
 
-// CheckDeltaPacks checks the delta packs for the m bundle to validate that all
-// necessary files are present. Full files are verified to have the correct
-// hash and delta files are verified to apply correctly with the correct
-// result.
-func CheckDeltaPacks(c *config.Config, m *swupd.Manifest) ([]string, error) {
+// deltaVersions returns the earlier versions of the content of m, which are
+// the versions a delta pack of m can update from
+func deltaVersions(m *swupd.Manifest) map[uint32]struct{} {
 	vers := make(map[uint32]struct{})
 	var exists = struct{}{}
 	for _, f := range m.Files {
-		vers[f.Version] = exists
+		if f.Version < m.Header.Version && f.Version != 0 {
+			vers[f.Version] = exists
+		}
+	}
+	return vers
+}
+
+// CheckDeltaPacks checks the delta packs for the m bundle to validate that all
+// necessary files are present. Full files are verified to have the correct
+// hash and delta files are verified to apply correctly with the correct
+// result. The versions of the bundle content with no delta pack to update from
+// are returned sorted along with the failures.
+func CheckDeltaPacks(c *config.Config, m *swupd.Manifest) ([]string, []uint32, error) {
+	vers := deltaVersions(m)
+	if len(vers) == 0 {
+		return nil, nil, nil
 	}
 
 	var wg sync.WaitGroup
@@ -353,6 +397,7 @@ func CheckDeltaPacks(c *config.Config, m *swupd.Manifest) ([]string, error) {
 	vCh := make(chan uint32)
 	errCh := make(chan error, workers)
 	failCh := make(chan string, workers)
+	missingCh := make(chan uint32, workers)
 
 	for i := 0; i < workers; i++ {
 		go func() {
@@ -372,6 +417,7 @@ func CheckDeltaPacks(c *config.Config, m *swupd.Manifest) ([]string, error) {
 				if err != nil {
 					// assume no delta pack
 					_ = os.RemoveAll(tmpDir)
+					missingCh <- v
 					continue
 				}
 
@@ -412,7 +458,40 @@ func CheckDeltaPacks(c *config.Config, m *swupd.Manifest) ([]string, error) {
 		fails = append(fails, <-failCh)
 	}
 
-	return fails, err
+	var missing []uint32
+	chanLen = len(missingCh)
+	for i := 0; i < chanLen; i++ {
+		missing = append(missing, <-missingCh)
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+
+	return fails, missing, err
+}
+
+// reportPacks records the result of checking the packs of a bundle. A delta
+// pack may be missing because the mixer no longer generates packs from an
+// old version, so missing packs only warn.
+func reportPacks(r *diva.Results, desc string, failures []string, missing []uint32) {
+	var diags []string
+	if len(failures) > 0 {
+		diags = append(diags, "pack issues:\n"+strings.Join(failures, "\n"))
+	}
+	if len(missing) > 0 {
+		var vers []string
+		for _, v := range missing {
+			vers = append(vers, fmt.Sprint(v))
+		}
+		diags = append(diags, "no delta pack from versions: "+strings.Join(vers, ", "))
+	}
+
+	switch {
+	case len(failures) > 0:
+		r.Ok(false, desc, diags...)
+	case len(missing) > 0:
+		r.Warn(desc, diags...)
+	default:
+		r.Ok(true, desc)
+	}
 }
 
 // CheckPacks validates the file contents of packs against manifest hashes
@@ -445,10 +524,15 @@ func CheckPacks(r *diva.Results, c *config.Config, version, minVer uint, delta b
 					break
 				}
 				var failures []string
+				var missing []uint32
 				var desc string
 				if delta {
-					failures, e = CheckDeltaPacks(c, m)
 					desc = "delta pack content correct for " + m.Name
+					if len(deltaVersions(m)) == 0 {
+						r.Skip(desc, "no content from an earlier version")
+						continue
+					}
+					failures, missing, e = CheckDeltaPacks(c, m)
 				} else {
 					failures, e = CheckZeroPack(c, m)
 					desc = "zero pack content correct for " + m.Name
@@ -458,10 +542,7 @@ func CheckPacks(r *diva.Results, c *config.Config, version, minVer uint, delta b
 					eCh <- e
 					break
 				}
-				r.Ok(len(failures) == 0, desc)
-				if len(failures) > 0 {
-					r.Diagnostic("pack issues:\n" + strings.Join(failures, "\n"))
-				}
+				reportPacks(r, desc, failures, missing)
 			}
 		}()
 	}
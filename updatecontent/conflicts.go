@@ -0,0 +1,106 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updatecontent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/clearlinux/diva/diva"
+	"github.com/clearlinux/diva/internal/config"
+
+	"github.com/clearlinux/mixer-tools/swupd"
+)
+
+var typeNames = map[swupd.TypeFlag]string{
+	swupd.TypeUnset:     "unset",
+	swupd.TypeFile:      "file",
+	swupd.TypeDirectory: "directory",
+	swupd.TypeLink:      "symlink",
+	swupd.TypeManifest:  "manifest",
+}
+
+// bundleFile is a manifest entry and the bundle that ships it
+type bundleFile struct {
+	bundle string
+	file   *swupd.File
+}
+
+// fileVariant is a distinct type and hash combination of a path
+type fileVariant struct {
+	typ  swupd.TypeFlag
+	hash swupd.Hashval
+}
+
+func (v fileVariant) String() string {
+	return fmt.Sprintf("%s %s", typeNames[v.typ], v.hash)
+}
+
+// bundleFileConflicts returns a description of every path that is shipped by
+// more than one of the manifests with a different type or hash, naming the
+// bundles that ship each variant. The result is sorted by path.
+func bundleFileConflicts(manifests []*swupd.Manifest) []string {
+	paths := make(map[string][]bundleFile)
+	for _, m := range manifests {
+		for _, f := range m.Files {
+			if !f.Present() {
+				continue
+			}
+			paths[f.Name] = append(paths[f.Name], bundleFile{bundle: m.Name, file: f})
+		}
+	}
+
+	var conflicts []string
+	for path, bfs := range paths {
+		variants := make(map[fileVariant][]string)
+		for _, bf := range bfs {
+			v := fileVariant{typ: bf.file.Type, hash: bf.file.Hash}
+			variants[v] = append(variants[v], bf.bundle)
+		}
+		if len(variants) < 2 {
+			continue
+		}
+
+		var desc []string
+		for v, bundles := range variants {
+			sort.Strings(bundles)
+			desc = append(desc, fmt.Sprintf("  %s in %s", v, strings.Join(bundles, ", ")))
+		}
+		sort.Strings(desc)
+		conflicts = append(conflicts, path+":\n"+strings.Join(desc, "\n"))
+	}
+
+	sort.Strings(conflicts)
+	return conflicts
+}
+
+// CheckBundleFileConflicts checks that every path shipped by more than one
+// bundle at version has the same type and hash in each of them. swupd picks
+// one of the variants when bundles disagree, so any difference is a failure.
+func CheckBundleFileConflicts(r *diva.Results, c *config.Config, version uint) error {
+	manifests, err := LoadBundleManifests(c, version)
+	if err != nil {
+		return err
+	}
+
+	conflicts := bundleFileConflicts(manifests)
+	r.Ok(len(conflicts) == 0, "files shipped by multiple bundles match across bundles")
+	for _, conflict := range conflicts {
+		r.Diagnostic(conflict)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updatecontent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/mixer-tools/swupd"
+)
+
+func TestBundleFileConflicts(t *testing.T) {
+	manifests := []*swupd.Manifest{
+		{
+			Name: "os-core",
+			Files: []*swupd.File{
+				{Name: "/etc/conf", Type: swupd.TypeFile, Hash: 1},
+				{Name: "/usr/bin", Type: swupd.TypeDirectory, Hash: 2},
+				{Name: "/usr/lib/thing", Type: swupd.TypeFile, Hash: 3},
+			},
+		},
+		{
+			Name: "editors",
+			Files: []*swupd.File{
+				{Name: "/etc/conf", Type: swupd.TypeFile, Hash: 4},
+				{Name: "/usr/bin", Type: swupd.TypeDirectory, Hash: 2},
+			},
+		},
+		{
+			Name: "devpkg",
+			Files: []*swupd.File{
+				{Name: "/etc/conf", Type: swupd.TypeFile, Hash: 1},
+				{Name: "/usr/lib/thing", Type: swupd.TypeLink, Hash: 3},
+			},
+		},
+	}
+
+	conflicts := bundleFileConflicts(manifests)
+	if len(conflicts) != 2 {
+		t.Fatalf("expected 2 conflicts but got %d: %v", len(conflicts), conflicts)
+	}
+	if !strings.HasPrefix(conflicts[0], "/etc/conf:") ||
+		!strings.Contains(conflicts[0], "in devpkg, os-core") ||
+		!strings.Contains(conflicts[0], "in editors") {
+		t.Errorf("unexpected conflict for /etc/conf: %s", conflicts[0])
+	}
+	if !strings.HasPrefix(conflicts[1], "/usr/lib/thing:") {
+		t.Errorf("unexpected conflict for /usr/lib/thing: %s", conflicts[1])
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updatecontent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/clearlinux/diva/bundle"
+	"github.com/clearlinux/diva/diva"
+	"github.com/clearlinux/diva/internal/config"
+	"github.com/clearlinux/diva/pkginfo"
+
+	"github.com/clearlinux/mixer-tools/swupd"
+)
+
+// generatedPaths are written by the mixer rather than shipped by an RPM
+var generatedPaths = map[string]bool{
+	"/usr/lib/os-release":           true,
+	"/usr/share/clear/version":      true,
+	"/usr/share/clear/versionstamp": true,
+}
+
+// bundleMarkerDir holds the files the mixer adds to mark a bundle installed
+const bundleMarkerDir = "/usr/share/clear/bundles/"
+
+var rpmTypes = map[swupd.TypeFlag]byte{
+	swupd.TypeFile:      'F',
+	swupd.TypeDirectory: 'D',
+	swupd.TypeLink:      'L',
+}
+
+// BundleContent is the result of comparing a bundle manifest with the files
+// shipped by the RPMs in the bundle definition. Missing lists the files
+// shipped by the RPMs that are not installed by the bundle, Extra the files in
+// the manifest that no RPM in the repo ships and Mismatched the files with a
+// different type or hash in the manifest than in the RPM that ships them.
+type BundleContent struct {
+	Bundle     string
+	Missing    []string
+	Extra      []string
+	Mismatched []string
+}
+
+// rpmFile is a file and the name of the RPM that ships it
+type rpmFile struct {
+	rpm  string
+	file *pkginfo.File
+}
+
+// manifestFiles returns the files present in m mapped by path
+func manifestFiles(m *swupd.Manifest) map[string]*swupd.File {
+	files := make(map[string]*swupd.File)
+	for _, f := range m.Files {
+		if f.Present() {
+			files[f.Name] = f
+		}
+	}
+	return files
+}
+
+// describeMismatch returns a description of how the manifest entry mf differs
+// from the RPM file rf, or an empty string if they match. The hashes are only
+// compared when the swupd hash of the RPM file was computed at import time.
+func describeMismatch(mf *swupd.File, rf rpmFile) string {
+	if t, ok := rpmTypes[mf.Type]; ok && t != rf.file.Type {
+		return fmt.Sprintf("%s: type %c in manifest, %c in %s", mf.Name, t, rf.file.Type, rf.rpm)
+	}
+	if rf.file.SwupdHash != "" && rf.file.SwupdHash != mf.Hash.String() {
+		return fmt.Sprintf("%s: hash %s in manifest, %s in %s", mf.Name, mf.Hash, rf.file.SwupdHash, rf.rpm)
+	}
+	return ""
+}
+
+// compareBundleContent compares the manifest of bundle b with the files
+// shipped by the RPMs in b.AllPackages. The files a bundle installs are the
+// files in its own manifest and in the manifests of every bundle it includes,
+// because the mixer drops files already installed by an included bundle from
+// the manifest. shipped holds every path shipped by any RPM in the repo.
+func compareBundleContent(b *bundle.Definition, manifests map[string]map[string]*swupd.File, rpms map[string]*pkginfo.RPM, shipped map[string]bool) BundleContent {
+	content := BundleContent{Bundle: b.Name}
+
+	expected := make(map[string]rpmFile)
+	for pkg := range b.AllPackages {
+		r, ok := rpms[pkg]
+		if !ok {
+			// missing packages are reported by check bundles
+			continue
+		}
+		for _, f := range r.Files {
+			expected[f.Name] = rpmFile{rpm: r.Name, file: f}
+		}
+	}
+
+	for path, rf := range expected {
+		var mf *swupd.File
+		for inc := range b.Includes {
+			if mf = manifests[inc][path]; mf != nil {
+				break
+			}
+		}
+		if mf == nil {
+			content.Missing = append(content.Missing, fmt.Sprintf("%s from %s", path, rf.rpm))
+			continue
+		}
+		if desc := describeMismatch(mf, rf); desc != "" {
+			content.Mismatched = append(content.Mismatched, desc)
+		}
+	}
+
+	for path, mf := range manifests[b.Name] {
+		switch {
+		case shipped[path], generatedPaths[path], strings.HasPrefix(path, bundleMarkerDir):
+			continue
+		case mf.Type == swupd.TypeDirectory:
+			// the mixer creates parent directories no RPM ships
+			continue
+		}
+		content.Extra = append(content.Extra, path)
+	}
+
+	sort.Strings(content.Missing)
+	sort.Strings(content.Extra)
+	sort.Strings(content.Mismatched)
+	return content
+}
+
+// CheckManifestContent checks that the manifest of every bundle in bundles at
+// version installs exactly the files shipped by the RPMs in repo that the
+// bundle definition lists, with matching types and hashes.
+func CheckManifestContent(r *diva.Results, c *config.Config, repo *pkginfo.Repo, bundles bundle.Set, version uint) error {
+	ms, err := LoadBundleManifests(c, version)
+	if err != nil {
+		return err
+	}
+	manifests := make(map[string]map[string]*swupd.File)
+	for _, m := range ms {
+		manifests[m.Name] = manifestFiles(m)
+	}
+
+	rpms := make(map[string]*pkginfo.RPM)
+	shipped := make(map[string]bool)
+	for _, rpm := range repo.Packages {
+		rpms[rpm.Name] = rpm
+		for _, f := range rpm.Files {
+			shipped[f.Name] = true
+		}
+	}
+
+	var names []string
+	for name := range bundles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		desc := fmt.Sprintf("Manifest.%s matches the packages in the bundle definition", name)
+		if _, ok := manifests[name]; !ok {
+			r.Ok(false, desc)
+			r.Diagnostic(fmt.Sprintf("no manifest for %s in the MoM", name))
+			continue
+		}
+
+		content := compareBundleContent(bundles[name], manifests, rpms, shipped)
+		r.Ok(len(content.Missing)+len(content.Extra)+len(content.Mismatched) == 0, desc)
+		if len(content.Missing) > 0 {
+			r.Diagnostic("files missing from manifest:\n" + strings.Join(content.Missing, "\n"))
+		}
+		if len(content.Extra) > 0 {
+			r.Diagnostic("files not shipped by any package:\n" + strings.Join(content.Extra, "\n"))
+		}
+		if len(content.Mismatched) > 0 {
+			r.Diagnostic("mismatched files:\n" + strings.Join(content.Mismatched, "\n"))
+		}
+	}
+
+	return nil
+}
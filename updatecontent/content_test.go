@@ -0,0 +1,79 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updatecontent
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/clearlinux/diva/bundle"
+	"github.com/clearlinux/diva/pkginfo"
+
+	"github.com/clearlinux/mixer-tools/swupd"
+)
+
+func TestCompareBundleContent(t *testing.T) {
+	b := &bundle.Definition{
+		Name:        "editors",
+		Includes:    map[string]bool{"editors": true, "os-core": true},
+		AllPackages: map[string]bool{"vim": true, "filesystem": true, "absent": true},
+	}
+
+	rpms := map[string]*pkginfo.RPM{
+		"vim": {Name: "vim", Files: []*pkginfo.File{
+			{Name: "/usr/bin/vim", Type: 'F'},
+			{Name: "/usr/share/vim", Type: 'D'},
+			{Name: "/usr/share/vim/vimrc", Type: 'F'},
+		}},
+		"filesystem": {Name: "filesystem", Files: []*pkginfo.File{
+			{Name: "/usr", Type: 'D'},
+		}},
+		"other": {Name: "other", Files: []*pkginfo.File{
+			{Name: "/usr/bin/other", Type: 'F'},
+		}},
+	}
+	shipped := make(map[string]bool)
+	for _, r := range rpms {
+		for _, f := range r.Files {
+			shipped[f.Name] = true
+		}
+	}
+
+	manifests := map[string]map[string]*swupd.File{
+		"os-core": {
+			"/usr": {Name: "/usr", Type: swupd.TypeDirectory},
+		},
+		"editors": {
+			"/usr/bin/vim":                  {Name: "/usr/bin/vim", Type: swupd.TypeFile},
+			"/usr/share/vim":                {Name: "/usr/share/vim", Type: swupd.TypeLink},
+			"/usr/bin/other":                {Name: "/usr/bin/other", Type: swupd.TypeFile},
+			"/usr/bin/stray":                {Name: "/usr/bin/stray", Type: swupd.TypeFile},
+			"/usr/bin":                      {Name: "/usr/bin", Type: swupd.TypeDirectory},
+			"/usr/share/clear/bundles/vim":  {Name: "/usr/share/clear/bundles/vim", Type: swupd.TypeFile},
+			"/usr/share/clear/versionstamp": {Name: "/usr/share/clear/versionstamp", Type: swupd.TypeFile},
+		},
+	}
+
+	expected := BundleContent{
+		Bundle:     "editors",
+		Missing:    []string{"/usr/share/vim/vimrc from vim"},
+		Extra:      []string{"/usr/bin/stray"},
+		Mismatched: []string{"/usr/share/vim: type L in manifest, D in vim"},
+	}
+	content := compareBundleContent(b, manifests, rpms, shipped)
+	if !reflect.DeepEqual(content, expected) {
+		t.Errorf("expected %+v but got %+v", expected, content)
+	}
+}
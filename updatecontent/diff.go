@@ -0,0 +1,184 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updatecontent
+
+import (
+	"sort"
+
+	"github.com/clearlinux/diva/internal/config"
+
+	"github.com/clearlinux/mixer-tools/swupd"
+)
+
+// Rename is a file that moved from one path to another with the same content
+type Rename struct {
+	From string
+	To   string
+}
+
+// BundleDiff describes how the content of a bundle changed between two
+// versions. Modified lists the files whose content or type changed, and
+// Renamed the pairs of deleted and added files with the same content.
+// SizeChange is the difference in content size of the bundle manifests.
+type BundleDiff struct {
+	Name       string
+	FromSize   uint64
+	ToSize     uint64
+	SizeChange int64
+	Added      []string
+	Deleted    []string
+	Modified   []string
+	Renamed    []Rename
+}
+
+// UpdateDiff is the difference between the bundles of two update versions.
+// Added and Removed list the bundles only in one of the versions, Changed the
+// bundles in both whose content changed.
+type UpdateDiff struct {
+	From    uint
+	To      uint
+	Added   []string
+	Removed []string
+	Changed []BundleDiff
+}
+
+// detectRenames moves the added and deleted files of d with the same content
+// to d.Renamed. Only regular files are considered, empty directories and
+// symlinks with equal hashes are too common to mean a rename.
+func detectRenames(d *BundleDiff, from, to map[string]*swupd.File) {
+	deletedByHash := make(map[swupd.Hashval][]string)
+	for _, path := range d.Deleted {
+		if f := from[path]; f.Type == swupd.TypeFile {
+			deletedByHash[f.Hash] = append(deletedByHash[f.Hash], path)
+		}
+	}
+
+	renamedFrom := make(map[string]bool)
+	var added []string
+	for _, path := range d.Added {
+		f := to[path]
+		candidates := deletedByHash[f.Hash]
+		if f.Type != swupd.TypeFile || len(candidates) == 0 {
+			added = append(added, path)
+			continue
+		}
+		d.Renamed = append(d.Renamed, Rename{From: candidates[0], To: path})
+		renamedFrom[candidates[0]] = true
+		deletedByHash[f.Hash] = candidates[1:]
+	}
+	d.Added = added
+
+	var deleted []string
+	for _, path := range d.Deleted {
+		if !renamedFrom[path] {
+			deleted = append(deleted, path)
+		}
+	}
+	d.Deleted = deleted
+}
+
+// diffBundle returns the differences between the from and to manifests of a
+// bundle and whether there are any
+func diffBundle(from, to *swupd.Manifest) (BundleDiff, bool) {
+	d := BundleDiff{
+		Name:       to.Name,
+		FromSize:   from.Header.ContentSize,
+		ToSize:     to.Header.ContentSize,
+		SizeChange: int64(to.Header.ContentSize) - int64(from.Header.ContentSize),
+	}
+
+	fromFiles := manifestFiles(from)
+	toFiles := manifestFiles(to)
+	for path, f := range toFiles {
+		old, ok := fromFiles[path]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, path)
+		case old.Hash != f.Hash || old.Type != f.Type:
+			d.Modified = append(d.Modified, path)
+		}
+	}
+	for path := range fromFiles {
+		if _, ok := toFiles[path]; !ok {
+			d.Deleted = append(d.Deleted, path)
+		}
+	}
+
+	sort.Strings(d.Added)
+	sort.Strings(d.Deleted)
+	sort.Strings(d.Modified)
+	detectRenames(&d, fromFiles, toFiles)
+
+	changed := d.SizeChange != 0 ||
+		len(d.Added)+len(d.Deleted)+len(d.Modified)+len(d.Renamed) > 0
+	return d, changed
+}
+
+// DiffManifests returns the bundles added, removed and changed between the
+// bundle manifests of two versions. Every list in the result is sorted.
+func DiffManifests(from, to []*swupd.Manifest) UpdateDiff {
+	var diff UpdateDiff
+
+	fromBundles := make(map[string]*swupd.Manifest)
+	for _, m := range from {
+		fromBundles[m.Name] = m
+	}
+	toBundles := make(map[string]*swupd.Manifest)
+	for _, m := range to {
+		toBundles[m.Name] = m
+	}
+
+	for name := range fromBundles {
+		if _, ok := toBundles[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	for name, m := range toBundles {
+		old, ok := fromBundles[name]
+		if !ok {
+			diff.Added = append(diff.Added, name)
+			continue
+		}
+		if d, changed := diffBundle(old, m); changed {
+			diff.Changed = append(diff.Changed, d)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return diff.Changed[i].Name < diff.Changed[j].Name
+	})
+	return diff
+}
+
+// DiffUpdates returns the difference between the bundle manifests of the from
+// and to update versions, downloading the manifests that are not cached yet.
+// The MoM of both versions must already be cached.
+func DiffUpdates(c *config.Config, from, to uint) (UpdateDiff, error) {
+	fromManifests, err := LoadBundleManifests(c, from)
+	if err != nil {
+		return UpdateDiff{}, err
+	}
+	toManifests, err := LoadBundleManifests(c, to)
+	if err != nil {
+		return UpdateDiff{}, err
+	}
+
+	diff := DiffManifests(fromManifests, toManifests)
+	diff.From = from
+	diff.To = to
+	return diff, nil
+}
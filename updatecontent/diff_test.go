@@ -0,0 +1,69 @@
+// Copyright © 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updatecontent
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/clearlinux/mixer-tools/swupd"
+)
+
+func TestDiffManifests(t *testing.T) {
+	from := []*swupd.Manifest{
+		{Name: "os-core", Header: swupd.ManifestHeader{ContentSize: 100}, Files: []*swupd.File{
+			{Name: "/usr/bin/same", Type: swupd.TypeFile, Hash: 1},
+			{Name: "/usr/bin/changed", Type: swupd.TypeFile, Hash: 2},
+			{Name: "/usr/bin/old-name", Type: swupd.TypeFile, Hash: 3},
+			{Name: "/usr/bin/gone", Type: swupd.TypeFile, Hash: 4},
+		}},
+		{Name: "unchanged", Files: []*swupd.File{
+			{Name: "/usr/share/doc", Type: swupd.TypeDirectory, Hash: 5},
+		}},
+		{Name: "dropped"},
+	}
+	to := []*swupd.Manifest{
+		{Name: "os-core", Header: swupd.ManifestHeader{ContentSize: 90}, Files: []*swupd.File{
+			{Name: "/usr/bin/same", Type: swupd.TypeFile, Hash: 1},
+			{Name: "/usr/bin/changed", Type: swupd.TypeFile, Hash: 6},
+			{Name: "/usr/bin/new-name", Type: swupd.TypeFile, Hash: 3},
+			{Name: "/usr/bin/new", Type: swupd.TypeFile, Hash: 7},
+		}},
+		{Name: "unchanged", Files: []*swupd.File{
+			{Name: "/usr/share/doc", Type: swupd.TypeDirectory, Hash: 5},
+		}},
+		{Name: "fresh"},
+	}
+
+	expected := UpdateDiff{
+		Added:   []string{"fresh"},
+		Removed: []string{"dropped"},
+		Changed: []BundleDiff{
+			{
+				Name:       "os-core",
+				FromSize:   100,
+				ToSize:     90,
+				SizeChange: -10,
+				Added:      []string{"/usr/bin/new"},
+				Deleted:    []string{"/usr/bin/gone"},
+				Modified:   []string{"/usr/bin/changed"},
+				Renamed:    []Rename{{From: "/usr/bin/old-name", To: "/usr/bin/new-name"}},
+			},
+		},
+	}
+	if diff := DiffManifests(from, to); !reflect.DeepEqual(diff, expected) {
+		t.Errorf("expected %+v but got %+v", expected, diff)
+	}
+}